@@ -0,0 +1,337 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/guillomep/external-dns-unbound-webhook/internal/config"
+	"github.com/guillomep/external-dns-unbound-webhook/internal/unbound"
+	"io"
+	"os"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+	"sigs.k8s.io/external-dns/provider"
+	"sigs.k8s.io/yaml"
+	"slices"
+	"strings"
+)
+
+const (
+	formatJSON = "json"
+	formatYAML = "yaml"
+	formatZone = "zone"
+)
+
+// errDifferences is returned by the diff command with --exit-code when there
+// are changes to apply.
+var errDifferences = errors.New("changes to apply")
+
+// command is a subcommand of the webhook for day-2 operations. The subcommands
+// never change Unbound.
+type command struct {
+	usage string
+	run   func(ctx context.Context, args []string, stdout io.Writer) error
+}
+
+var commands = map[string]command{
+	"validate": {
+		usage: "Check the configuration and the connectivity to the Unbound instances",
+		run:   runValidate,
+	},
+	"export": {
+		usage: "Print the managed records as JSON, YAML or zone file",
+		run:   runExport,
+	},
+	"diff": {
+		usage: "Print the changes needed to get from the records of Unbound to the endpoints of a file",
+		run:   runDiff,
+	},
+}
+
+// usage prints the usage of the webhook and of its subcommands.
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [command] [flags]\n\nWithout command, the webhook is served.\n\nCommands:\n", os.Args[0])
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "  %-10s %s\n", name, commands[name].usage)
+	}
+	fmt.Fprintf(out, "\nRun %s <command> -h for the flags of a command.\n\nFlags:\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+// runCommand runs a subcommand and returns the exit code of the webhook.
+func runCommand(name string, args []string) int {
+	err := commands[name].run(context.Background(), args, os.Stdout)
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, flag.ErrHelp), errors.Is(err, errDifferences):
+	default:
+		logErrors(err)
+	}
+	return exitCommandFailed
+}
+
+// newFlagSet returns the flags of a subcommand, with the configuration file.
+func newFlagSet(name string) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	configPath := flags.String("config", "", "Path of the YAML configuration file, the environment variables override its settings")
+	return flags, configPath
+}
+
+// loadProvider loads the configuration and returns a provider that changes
+// neither Unbound nor the persisted records.
+func loadProvider(path string) (*unbound.UnboundProvider, error) {
+	webhookConfig, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	providerConfig := webhookConfig.Unbound
+	providerConfig.DryRun = true
+	providerConfig.PersistPath = ""
+	return unbound.NewProvider(&providerConfig)
+}
+
+// instanceChecker checks the instances of a provider one by one.
+type instanceChecker interface {
+	CheckInstances() []unbound.InstanceStatus
+}
+
+func runValidate(ctx context.Context, args []string, stdout io.Writer) error {
+	flags, configPath := newFlagSet("validate")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	p, err := loadProvider(*configPath)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, "Configuration is valid.")
+	return checkInstances(p, stdout)
+}
+
+// checkInstances prints the status of the instances, and fails if one of them
+// is not reachable.
+func checkInstances(p instanceChecker, stdout io.Writer) error {
+	statuses := p.CheckInstances()
+	unreachable := 0
+	for _, status := range statuses {
+		if status.Err != nil {
+			unreachable++
+			fmt.Fprintf(stdout, "%s: not reachable: %v\n", status.Host, status.Err)
+			continue
+		}
+		fmt.Fprintf(stdout, "%s: reachable\n", status.Host)
+	}
+
+	if unreachable > 0 {
+		return fmt.Errorf("%d of %d Unbound instances are not reachable", unreachable, len(statuses))
+	}
+	return nil
+}
+
+func runExport(ctx context.Context, args []string, stdout io.Writer) error {
+	flags, configPath := newFlagSet("export")
+	format := flags.String("format", formatJSON, "Format of the records: json, yaml or zone")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if !slices.Contains([]string{formatJSON, formatYAML, formatZone}, *format) {
+		return fmt.Errorf("unknown format %q, expected json, yaml or zone", *format)
+	}
+
+	p, err := loadProvider(*configPath)
+	if err != nil {
+		return err
+	}
+	return export(ctx, p, *format, stdout)
+}
+
+// export prints the records of the provider, filtered like ExternalDNS reads
+// them, sorted by name and type.
+func export(ctx context.Context, p provider.Provider, format string, stdout io.Writer) error {
+	endpoints, err := p.Records(ctx)
+	if err != nil {
+		return fmt.Errorf("could not read the records: %w", err)
+	}
+	slices.SortStableFunc(endpoints, func(a, b *endpoint.Endpoint) int {
+		return cmp.Or(
+			cmp.Compare(a.DNSName, b.DNSName),
+			cmp.Compare(a.RecordType, b.RecordType),
+			cmp.Compare(endpointView(a), endpointView(b)),
+		)
+	})
+
+	switch format {
+	case formatYAML:
+		content, err := yaml.Marshal(endpoints)
+		if err != nil {
+			return err
+		}
+		_, err = stdout.Write(content)
+		return err
+	case formatZone:
+		return writeZone(stdout, endpoints)
+	default:
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(endpoints)
+	}
+}
+
+// endpointView returns the views of an endpoint, empty for the global local
+// data.
+func endpointView(ep *endpoint.Endpoint) string {
+	view, _ := ep.GetProviderSpecificProperty(unbound.PropertyView)
+	return view
+}
+
+// writeZone prints the records of the endpoints in the zone file format. The
+// view of the records, which cannot be represented, is added as a comment.
+func writeZone(stdout io.Writer, endpoints []*endpoint.Endpoint) error {
+	for _, ep := range endpoints {
+		name := ep.DNSName
+		if !strings.HasSuffix(name, ".") {
+			name += "."
+		}
+
+		var comment string
+		if view := endpointView(ep); view != "" {
+			comment = fmt.Sprintf("\t; view %s", view)
+		}
+
+		for _, target := range ep.Targets {
+			if _, err := fmt.Fprintf(stdout, "%s\t%d\tIN\t%s\t%s%s\n", name, ep.RecordTTL, ep.RecordType, target, comment); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// planner is the provider of the diff command.
+type planner interface {
+	provider.Provider
+	PlanChanges(changes *plan.Changes) []*unbound.UnboundChange
+}
+
+// diffOptions are the options of the plan of the diff command.
+type diffOptions struct {
+	policy      plan.Policy
+	recordTypes []string
+}
+
+func runDiff(ctx context.Context, args []string, stdout io.Writer) error {
+	flags, configPath := newFlagSet("diff")
+	file := flags.String("file", "", "Path of the JSON or YAML file listing the desired endpoints, - for the standard input")
+	policy := flags.String("policy", "sync", "Policy of the changes, like the one of ExternalDNS: sync, upsert-only or create-only")
+	recordTypes := flags.String("managed-record-types", "A,AAAA,CNAME", "Comma separated record types to manage, like the ones of ExternalDNS")
+	exitCode := flags.Bool("exit-code", false, "Exit with code 1 if there are changes to apply")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *file == "" {
+		return errors.New("missing file of the desired endpoints, set it with --file")
+	}
+	options := diffOptions{policy: plan.Policies[*policy], recordTypes: strings.Split(*recordTypes, ",")}
+	if options.policy == nil {
+		return fmt.Errorf("unknown policy %q, expected sync, upsert-only or create-only", *policy)
+	}
+
+	desired, err := readEndpoints(*file)
+	if err != nil {
+		return err
+	}
+
+	p, err := loadProvider(*configPath)
+	if err != nil {
+		return err
+	}
+
+	changed, err := diff(ctx, p, desired, options, stdout)
+	if err != nil {
+		return err
+	}
+	if changed && *exitCode {
+		return errDifferences
+	}
+	return nil
+}
+
+// readEndpoints reads the endpoints listed in a JSON or YAML file, or in the
+// standard input.
+func readEndpoints(path string) ([]*endpoint.Endpoint, error) {
+	var content []byte
+	var err error
+	if path == "-" {
+		content, err = io.ReadAll(os.Stdin)
+	} else {
+		content, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read the desired endpoints: %w", err)
+	}
+
+	endpoints := []*endpoint.Endpoint{}
+	if err := yaml.UnmarshalStrict(content, &endpoints); err != nil {
+		return nil, fmt.Errorf("invalid desired endpoints in %s: %w", path, err)
+	}
+	return endpoints, nil
+}
+
+// diff prints the changes ExternalDNS would plan to get from the records of
+// the provider to the desired endpoints, and the changes of the records the
+// provider would apply. It returns true if there are changes.
+func diff(ctx context.Context, p planner, desired []*endpoint.Endpoint, options diffOptions, stdout io.Writer) (bool, error) {
+	current, err := p.Records(ctx)
+	if err != nil {
+		return false, fmt.Errorf("could not read the records: %w", err)
+	}
+	desired, err = p.AdjustEndpoints(desired)
+	if err != nil {
+		return false, fmt.Errorf("could not adjust the desired endpoints: %w", err)
+	}
+
+	// The records are compared as is, without the TXT registry of ExternalDNS
+	changes := (&plan.Plan{
+		Current:        current,
+		Desired:        desired,
+		Policies:       []plan.Policy{options.policy},
+		DomainFilter:   endpoint.MatchAllDomainFilters{p.GetDomainFilter()},
+		ManagedRecords: options.recordTypes,
+	}).Calculate().Changes
+
+	if !changes.HasChanges() {
+		fmt.Fprintln(stdout, "No changes, the records are up to date.")
+		return false, nil
+	}
+
+	fmt.Fprintln(stdout, "Planned changes:")
+	for _, ep := range changes.Create {
+		fmt.Fprintf(stdout, "  create %s\n", ep)
+	}
+	for i := range changes.UpdateNew {
+		fmt.Fprintf(stdout, "  update %s\n", changes.UpdateOld[i])
+		fmt.Fprintf(stdout, "      to %s\n", changes.UpdateNew[i])
+	}
+	for _, ep := range changes.Delete {
+		fmt.Fprintf(stdout, "  delete %s\n", ep)
+	}
+
+	fmt.Fprintln(stdout, "\nUnbound changes:")
+	for _, change := range p.PlanChanges(changes) {
+		fmt.Fprintf(stdout, "  %s\n", change)
+	}
+	return true, nil
+}
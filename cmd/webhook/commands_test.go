@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"github.com/guillomep/external-dns-unbound-webhook/internal/unbound"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+	"strings"
+	"testing"
+)
+
+// recordsProvider is an Unbound provider reading fixed records.
+type recordsProvider struct {
+	*unbound.UnboundProvider
+	records []*endpoint.Endpoint
+	err     error
+}
+
+func (p *recordsProvider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
+	return p.records, p.err
+}
+
+func newRecordsProvider(t *testing.T, records ...*endpoint.Endpoint) *recordsProvider {
+	p, err := unbound.NewProvider(&unbound.Configuration{
+		Host:       []string{"tcp://127.0.0.1:8953"},
+		DefaultTTL: 300,
+		DryRun:     true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &recordsProvider{UnboundProvider: p, records: records}
+}
+
+// statusProvider returns fixed statuses of the instances.
+type statusProvider []unbound.InstanceStatus
+
+func (p statusProvider) CheckInstances() []unbound.InstanceStatus {
+	return p
+}
+
+func TestCheckInstances(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []unbound.InstanceStatus
+		output   string
+		err      string
+	}{
+		{
+			name:     "reachable",
+			statuses: []unbound.InstanceStatus{{Host: "tcp://unbound-0:8953"}, {Host: "tcp://unbound-1:8953"}},
+			output:   "tcp://unbound-0:8953: reachable\ntcp://unbound-1:8953: reachable\n",
+		},
+		{
+			name: "not reachable",
+			statuses: []unbound.InstanceStatus{
+				{Host: "tcp://unbound-0:8953"},
+				{Host: "tcp://unbound-1:8953", Err: errors.New("connection refused")},
+			},
+			output: "tcp://unbound-0:8953: reachable\ntcp://unbound-1:8953: not reachable: connection refused\n",
+			err:    "1 of 2 Unbound instances are not reachable",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout := &bytes.Buffer{}
+			err := checkInstances(statusProvider(tt.statuses), stdout)
+			if tt.err == "" {
+				assert.Nil(t, err)
+			} else {
+				assert.EqualError(t, err, tt.err)
+			}
+			assert.Equal(t, tt.output, stdout.String())
+		})
+	}
+}
+
+func TestExport(t *testing.T) {
+	records := func() []*endpoint.Endpoint {
+		return []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("b.test.lan", "A", 300, "192.168.1.2", "192.168.1.3"),
+			endpoint.NewEndpointWithTTL("a.test.lan", "TXT", 60, `"text"`).WithProviderSpecific(unbound.PropertyView, "office"),
+			endpoint.NewEndpointWithTTL("a.test.lan", "A", 300, "192.168.1.1"),
+		}
+	}
+
+	t.Run("zone", func(t *testing.T) {
+		stdout := &bytes.Buffer{}
+		assert.Nil(t, export(context.TODO(), newRecordsProvider(t, records()...), formatZone, stdout))
+		assert.Equal(t, "a.test.lan.\t300\tIN\tA\t192.168.1.1\n"+
+			"a.test.lan.\t60\tIN\tTXT\t\"text\"\t; view office\n"+
+			"b.test.lan.\t300\tIN\tA\t192.168.1.2\n"+
+			"b.test.lan.\t300\tIN\tA\t192.168.1.3\n", stdout.String())
+	})
+
+	for _, format := range []string{formatJSON, formatYAML} {
+		t.Run(format, func(t *testing.T) {
+			stdout := &bytes.Buffer{}
+			assert.Nil(t, export(context.TODO(), newRecordsProvider(t, records()...), format, stdout))
+
+			// The export can be read back as desired endpoints of the diff
+			path := filepath.Join(t.TempDir(), "records."+format)
+			if err := os.WriteFile(path, stdout.Bytes(), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			endpoints, err := readEndpoints(path)
+			assert.Nil(t, err)
+			expected := records()
+			for _, ep := range expected {
+				ep.Labels = nil
+			}
+			assert.Equal(t, []*endpoint.Endpoint{expected[2], expected[1], expected[0]}, endpoints)
+		})
+	}
+
+	t.Run("records error", func(t *testing.T) {
+		p := newRecordsProvider(t)
+		p.err = errors.New("connection refused")
+		err := export(context.TODO(), p, formatJSON, &bytes.Buffer{})
+		assert.EqualError(t, err, "could not read the records: connection refused")
+	})
+}
+
+func TestReadEndpoints(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "endpoints.yaml")
+	if err := os.WriteFile(path, []byte("- dnsName: a.test.lan\n  unknown: true\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := readEndpoints(path)
+	assert.ErrorContains(t, err, "invalid desired endpoints in "+path)
+	assert.ErrorContains(t, err, `unknown field "unknown"`)
+
+	_, err = readEndpoints(filepath.Join(dir, "missing.yaml"))
+	assert.ErrorContains(t, err, "could not read the desired endpoints")
+}
+
+func TestDiff(t *testing.T) {
+	current := func() []*endpoint.Endpoint {
+		return []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("a.test.lan", "A", 300, "192.168.1.1"),
+			endpoint.NewEndpointWithTTL("b.test.lan", "A", 300, "192.168.1.2"),
+			endpoint.NewEndpointWithTTL("c.test.lan", "A", 300, "192.168.1.3"),
+		}
+	}
+
+	tests := []struct {
+		name    string
+		desired []*endpoint.Endpoint
+		policy  string
+		changed bool
+		output  string
+	}{
+		{
+			name:    "no changes",
+			desired: current(),
+			policy:  "sync",
+			output:  "No changes, the records are up to date.\n",
+		},
+		{
+			name: "sync",
+			desired: []*endpoint.Endpoint{
+				endpoint.NewEndpointWithTTL("a.test.lan", "A", 300, "192.168.1.1"),
+				endpoint.NewEndpointWithTTL("b.test.lan", "A", 300, "192.168.1.20"),
+				endpoint.NewEndpointWithTTL("d.test.lan", "CNAME", 300, "a.test.lan"),
+			},
+			policy:  "sync",
+			changed: true,
+			output: "Planned changes:\n" +
+				"  create d.test.lan. 300 IN CNAME  a.test.lan []\n" +
+				"  update b.test.lan 300 IN A  192.168.1.2 []\n" +
+				"      to b.test.lan. 300 IN A  192.168.1.20 []\n" +
+				"  delete c.test.lan 300 IN A  192.168.1.3 []\n" +
+				"\nUnbound changes:\n" +
+				"  CREATE\td.test.lan.\t300\tIN\tCNAME\ta.test.lan\n" +
+				"  REMOVE\tb.test.lan\t300\tIN\tA\t192.168.1.2\n" +
+				"  CREATE\tb.test.lan.\t300\tIN\tA\t192.168.1.20\n" +
+				"  REMOVE\tc.test.lan\t300\tIN\tA\t192.168.1.3\n",
+		},
+		{
+			name: "upsert-only",
+			desired: []*endpoint.Endpoint{
+				endpoint.NewEndpointWithTTL("a.test.lan", "A", 300, "192.168.1.1"),
+				endpoint.NewEndpointWithTTL("b.test.lan", "A", 300, "192.168.1.2"),
+			},
+			policy: "upsert-only",
+			output: "No changes, the records are up to date.\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout := &bytes.Buffer{}
+			options := diffOptions{policy: plan.Policies[tt.policy], recordTypes: []string{"A", "AAAA", "CNAME"}}
+			changed, err := diff(context.TODO(), newRecordsProvider(t, current()...), tt.desired, options, stdout)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.changed, changed)
+			assert.Equal(t, tt.output, stdout.String())
+		})
+	}
+}
+
+func TestCommandFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		args    []string
+		err     string
+	}{
+		{
+			name:    "unknown format",
+			command: "export",
+			args:    []string{"--format", "xml"},
+			err:     `unknown format "xml", expected json, yaml or zone`,
+		},
+		{
+			name:    "missing file",
+			command: "diff",
+			err:     "missing file of the desired endpoints, set it with --file",
+		},
+		{
+			name:    "unknown policy",
+			command: "diff",
+			args:    []string{"--file", "endpoints.yaml", "--policy", "delete-all"},
+			err:     `unknown policy "delete-all", expected sync, upsert-only or create-only`,
+		},
+		{
+			name:    "unknown flag",
+			command: "validate",
+			args:    []string{"--unknown"},
+			err:     "flag provided but not defined: -unknown",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := commands[tt.command].run(context.TODO(), tt.args, &bytes.Buffer{})
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+
+	err := commands["validate"].run(context.TODO(), []string{"-h"}, &bytes.Buffer{})
+	assert.True(t, errors.Is(err, flag.ErrHelp))
+}
+
+func TestValidateCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "unbound_host: [tcp://127.0.0.1:1]\nunbound_retry_attempts: 0\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := &bytes.Buffer{}
+	err := runValidate(context.TODO(), []string{"--config", path}, stdout)
+	assert.EqualError(t, err, "1 of 1 Unbound instances are not reachable")
+	assert.True(t, strings.HasPrefix(stdout.String(), "Configuration is valid.\ntcp://127.0.0.1:1: not reachable: "))
+}
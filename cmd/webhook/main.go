@@ -1,45 +1,117 @@
 package main
 
 import (
-	"github.com/codingconcepts/env"
+	"context"
+	"errors"
+	"flag"
+	"github.com/guillomep/external-dns-unbound-webhook/internal/config"
 	"github.com/guillomep/external-dns-unbound-webhook/internal/server"
 	"github.com/guillomep/external-dns-unbound-webhook/internal/unbound"
 	log "github.com/sirupsen/logrus"
 	"os"
 	"os/signal"
-	"sigs.k8s.io/external-dns/provider/webhook/api"
+	"sigs.k8s.io/external-dns/provider"
+	"strings"
 	"syscall"
 )
 
-// loop waits for a SIGTERM or a SIGINT and then shuts down the server.
-func loop(status *server.HealthStatus) {
-	exitSignal := make(chan os.Signal, 1)
-	signal.Notify(exitSignal, syscall.SIGINT, syscall.SIGTERM)
-	signal := <-exitSignal
+const (
+	// exitOK is the exit code of a clean shutdown.
+	exitOK = 0
+	// exitCommandFailed is the exit code of a failed subcommand, like the
+	// exit code of log.Fatal on a startup failure.
+	exitCommandFailed = 1
+	// exitShutdownFailed is the exit code when the servers could not be
+	// shut down before the deadline, interrupting in-flight requests. It is
+	// distinct from the startup failures, 2 being the usage errors.
+	exitShutdownFailed = 3
+)
 
-	log.Infof("Signal %s received. Shutting down the webhook.", signal.String())
-	status.SetHealth(false)
-	status.SetReady(false)
+// webhookProvider is the provider served by the webhook.
+type webhookProvider interface {
+	provider.Provider
+	server.Checker
 }
 
-func main() {
-	// Read server options
-	serverOptions := &server.ServerOptions{}
-	if err := env.Set(serverOptions); err != nil {
-		log.Fatal(err)
-	}
+// run starts the servers and serves the provider until a signal is received,
+// then gracefully shuts the servers down. It returns the exit code of the
+// webhook.
+func run(ctx context.Context, provider webhookProvider, options server.ServerOptions, signals <-chan os.Signal) int {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
 	// Start health server
-	log.Infof("Starting liveness and readiness server on %s", serverOptions.GetHealthAddress())
+	log.Infof("Starting liveness and readiness server on %s", options.GetHealthAddress())
 	healthStatus := server.HealthStatus{}
 	healthServer := server.HealthServer{}
-	go healthServer.Start(&healthStatus, nil, *serverOptions)
+	healthStartedChan := make(chan struct{})
+	go healthServer.Start(&healthStatus, healthStartedChan, options)
+	<-healthStartedChan
 
-	// Read provider configuration
-	providerConfig := &unbound.Configuration{}
-	if err := env.Set(providerConfig); err != nil {
-		log.Fatal(err)
+	// Start the webhook
+	log.Infof("Starting webhook server on %s", options.GetWebhookAddress())
+	webhookServer := server.WebhookServer{}
+	startedChan := make(chan struct{})
+	go webhookServer.Start(provider, startedChan, options)
+
+	// Wait for the HTTP server to start and then set the healthy flag, the
+	// ready flag follows the connectivity to Unbound
+	<-startedChan
+	healthStatus.SetHealth(true)
+	go server.NewReadinessProbe(provider, options).Run(ctx, &healthStatus)
+
+	// Wait until a signal tells us to exit
+	signal := <-signals
+	log.Infof("Signal %s received. Shutting down the webhook.", signal.String())
+
+	cancel()
+	healthStatus.SetHealth(false)
+	healthStatus.SetNotReady("shutting down")
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), options.GetShutdownTimeout())
+	defer shutdownCancel()
+
+	// Wait for the in-flight changes before stopping the health server
+	err := webhookServer.Shutdown(shutdownCtx)
+	err = errors.Join(err, healthServer.Shutdown(shutdownCtx))
+	if err != nil {
+		log.Errorf("Could not gracefully shut down the webhook: %v", err)
+		return exitShutdownFailed
+	}
+
+	log.Info("Webhook stopped.")
+	return exitOK
+}
+
+// logErrors logs an error, one line per line of its message, like the
+// invalid settings of the configuration.
+func logErrors(err error) {
+	for _, line := range strings.Split(err.Error(), "\n") {
+		log.Error(strings.TrimSpace(line))
+	}
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		if _, ok := commands[os.Args[1]]; ok {
+			os.Exit(runCommand(os.Args[1], os.Args[2:]))
+		}
+	}
+
+	configPath := flag.String("config", "", "Path of the YAML configuration file, the environment variables override its settings")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() > 0 {
+		log.Fatalf("Unknown command %q, run with -h for the usage", flag.Arg(0))
+	}
+
+	// Read the server options and the provider configuration
+	webhookConfig, err := config.Load(*configPath)
+	if err != nil {
+		logErrors(err)
+		log.Fatal("Invalid configuration")
 	}
+	serverOptions, providerConfig := &webhookConfig.Server, &webhookConfig.Unbound
 
 	// instantiate the Unbound provider
 	provider, err := unbound.NewProvider(providerConfig)
@@ -47,21 +119,21 @@ func main() {
 		log.Fatal(err)
 	}
 
-	// Start the webhook
-	log.Infof("Starting webhook server on %s", serverOptions.GetWebhookAddress())
-	startedChan := make(chan struct{})
-	go api.StartHTTPApi(
-		provider, startedChan,
-		serverOptions.GetReadTimeout(),
-		serverOptions.GetWriteTimeout(),
-		serverOptions.GetWebhookAddress(),
-	)
-
-	// Wait for the HTTP server to start and then set the healthy and ready flags
-	<-startedChan
-	healthStatus.SetHealth(true)
-	healthStatus.SetReady(true)
+	// Start the reconciliation of the Unbound instances
+	ctx, cancel := context.WithCancel(context.Background())
+	if interval := providerConfig.GetReconcileInterval(); interval > 0 {
+		go provider.StartReconciler(ctx, interval)
+	}
+
+	// Watch the TLS files of the Unbound instances
+	if interval := providerConfig.GetTLSReloadInterval(); interval > 0 {
+		go provider.StartCertificateReloader(ctx, interval)
+	}
+
+	exitSignal := make(chan os.Signal, 1)
+	signal.Notify(exitSignal, syscall.SIGINT, syscall.SIGTERM)
 
-	// Loops until a signal tells us to exit
-	loop(&healthStatus)
+	code := run(ctx, provider, *serverOptions, exitSignal)
+	cancel()
+	os.Exit(code)
 }
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/guillomep/external-dns-unbound-webhook/internal/server"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"net/http"
+	"os"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+	"sigs.k8s.io/external-dns/provider"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// slowProvider takes some time to apply changes.
+type slowProvider struct {
+	provider.BaseProvider
+	delay   time.Duration
+	applied atomic.Bool
+}
+
+func (p *slowProvider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
+	return []*endpoint.Endpoint{}, nil
+}
+
+func (p *slowProvider) ApplyChanges(ctx context.Context, changes *plan.Changes) error {
+	time.Sleep(p.delay)
+	p.applied.Store(true)
+	return nil
+}
+
+func (p *slowProvider) Check() error {
+	return nil
+}
+
+// testClient does not keep the connections alive, an idle connection would
+// delay the shutdown of the servers until its deadline.
+var testClient = &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+func getFreePort(t *testing.T) uint16 {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Cannot find free port for test")
+	}
+	defer l.Close()
+	return uint16(l.Addr().(*net.TCPAddr).Port)
+}
+
+// startRun runs the webhook and returns the channel to send signals to and
+// the channel receiving the exit code.
+func startRun(t *testing.T, p webhookProvider, options server.ServerOptions) (chan os.Signal, chan int) {
+	signals := make(chan os.Signal, 1)
+	code := make(chan int, 1)
+	go func() {
+		code <- run(context.Background(), p, options, signals)
+	}()
+
+	url := fmt.Sprintf("http://%s/", options.GetWebhookAddress())
+	assert.Eventually(t, func() bool {
+		res, err := testClient.Get(url)
+		if err != nil {
+			return false
+		}
+		res.Body.Close()
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+
+	return signals, code
+}
+
+func testOptions(t *testing.T, shutdownTimeout int) server.ServerOptions {
+	return server.ServerOptions{
+		WebhookHost:               "127.0.0.1",
+		WebhookPort:               getFreePort(t),
+		HealthHost:                "127.0.0.1",
+		HealthPort:                getFreePort(t),
+		ReadTimeout:               60000,
+		WriteTimeout:              60000,
+		ReadinessProbeInterval:    10000,
+		ReadinessFailureThreshold: 1,
+		ShutdownTimeout:           shutdownTimeout,
+	}
+}
+
+// applyChanges sends changes to the webhook in background.
+func applyChanges(options server.ServerOptions) chan int {
+	status := make(chan int, 1)
+	go func() {
+		res, err := testClient.Post(fmt.Sprintf("http://%s/records", options.GetWebhookAddress()), "application/json", strings.NewReader("{}"))
+		if err != nil {
+			status <- 0
+			return
+		}
+		res.Body.Close()
+		status <- res.StatusCode
+	}()
+	return status
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	p := &slowProvider{delay: 500 * time.Millisecond}
+	options := testOptions(t, 5000)
+	signals, code := startRun(t, p, options)
+
+	status := applyChanges(options)
+	time.Sleep(100 * time.Millisecond)
+	signals <- syscall.SIGTERM
+
+	assert.Equal(t, http.StatusNoContent, <-status)
+	assert.True(t, p.applied.Load())
+	assert.Equal(t, exitOK, <-code)
+
+	// The servers do not accept requests anymore
+	_, err := testClient.Get(fmt.Sprintf("http://%s/records", options.GetWebhookAddress()))
+	assert.NotNil(t, err)
+	_, err = testClient.Get(fmt.Sprintf("http://%s/health", options.GetHealthAddress()))
+	assert.NotNil(t, err)
+}
+
+func TestGracefulShutdownDeadline(t *testing.T) {
+	p := &slowProvider{delay: time.Second}
+	options := testOptions(t, 100)
+	signals, code := startRun(t, p, options)
+
+	status := applyChanges(options)
+	time.Sleep(100 * time.Millisecond)
+	signals <- syscall.SIGINT
+
+	assert.Equal(t, exitShutdownFailed, <-code)
+	<-status
+}
@@ -0,0 +1,110 @@
+// Package config loads the configuration of the webhook from a YAML file and
+// from the environment variables.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+
+	"github.com/codingconcepts/env"
+	"github.com/guillomep/external-dns-unbound-webhook/internal/server"
+	"github.com/guillomep/external-dns-unbound-webhook/internal/unbound"
+	"go.yaml.in/yaml/v3"
+)
+
+// Config is the configuration of the webhook. In the configuration file, the
+// settings are named after their environment variables in lower case.
+type Config struct {
+	Server  server.ServerOptions  `yaml:",inline"`
+	Unbound unbound.Configuration `yaml:",inline"`
+}
+
+// Load reads the configuration of the webhook from the file at path, if any,
+// and from the environment variables. The environment variables that are set
+// override the file, which overrides the default values. All the invalid
+// settings are reported at once.
+func Load(path string) (*Config, error) {
+	config := &Config{}
+	sections := []any{&config.Server, &config.Unbound}
+
+	var errs []error
+	for _, section := range sections {
+		errs = append(errs, setFields(section, false)...)
+	}
+	if path != "" {
+		errs = append(errs, readFile(path, config))
+	}
+	for _, section := range sections {
+		errs = append(errs, setFields(section, true)...)
+	}
+	errs = append(errs, config.Server.Validate(), config.Unbound.Validate())
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// readFile decodes the configuration file into the configuration. The keys
+// that are not settings are rejected.
+func readFile(path string, config *Config) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("could not read the configuration file: %w", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid configuration file %s: %w", path, err)
+	}
+	return nil
+}
+
+// setFields sets the fields of a section from their environment variables if
+// environment is true, to their default values otherwise. Only the fields
+// whose environment variable is set, respectively not set, are changed.
+func setFields(section any, environment bool) []error {
+	value := reflect.ValueOf(section).Elem()
+
+	var errs []error
+	for i := range value.NumField() {
+		field := value.Type().Field(i)
+		name, ok := field.Tag.Lookup("env")
+		if !ok {
+			continue
+		}
+		if _, set := os.LookupEnv(name); set != environment {
+			continue
+		}
+		if err := setField(field, value.Field(i)); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s: %w", name, err))
+		}
+	}
+	return errs
+}
+
+// setField sets a field with env.Set, so the values are parsed the same way
+// with or without configuration file. The field is set from its environment
+// variable if set, to its default value otherwise.
+func setField(field reflect.StructField, value reflect.Value) error {
+	tag := fmt.Sprintf("env:%q", field.Tag.Get("env"))
+	if defaultValue, ok := field.Tag.Lookup("default"); ok {
+		tag += fmt.Sprintf(" default:%q", defaultValue)
+	}
+
+	holder := reflect.New(reflect.StructOf([]reflect.StructField{{
+		Name: field.Name,
+		Type: field.Type,
+		Tag:  reflect.StructTag(tag),
+	}}))
+	if err := env.Set(holder.Interface()); err != nil {
+		return err
+	}
+	value.Set(holder.Elem().Field(0))
+	return nil
+}
@@ -0,0 +1,152 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeConfig writes a configuration file in the test directory and returns
+// its path.
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	t.Setenv("UNBOUND_HOST", "tcp://unbound:8953")
+
+	// Without file, the environment variables and the default values are used
+	config, err := Load("")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"tcp://unbound:8953"}, config.Unbound.Host)
+	assert.Equal(t, "fail", config.Unbound.FailurePolicy)
+	assert.Equal(t, 300, config.Unbound.DefaultTTL)
+	assert.Equal(t, uint16(8888), config.Server.WebhookPort)
+	assert.Equal(t, 10000, config.Server.ReadinessProbeInterval)
+}
+
+func TestLoadFile(t *testing.T) {
+	path := writeConfig(t, `
+unbound_host:
+  - tcp://unbound-1:8953
+  - tcp://unbound-2:8953
+unbound_failure_policy: tolerate
+domain_filter:
+  - example.com
+  - example.org
+default_ttl: 600
+webhook_port: 9999
+dry_run: true
+`)
+
+	// The file overrides the default values
+	config, err := Load(path)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"tcp://unbound-1:8953", "tcp://unbound-2:8953"}, config.Unbound.Host)
+	assert.Equal(t, "tolerate", config.Unbound.FailurePolicy)
+	assert.Equal(t, []string{"example.com", "example.org"}, config.Unbound.DomainFilter)
+	assert.Equal(t, 600, config.Unbound.DefaultTTL)
+	assert.True(t, config.Unbound.DryRun)
+	assert.Equal(t, uint16(9999), config.Server.WebhookPort)
+	assert.Equal(t, "localhost", config.Server.WebhookHost)
+	assert.Equal(t, 3, config.Unbound.RetryAttempts)
+
+	// The environment variables that are set override the file
+	t.Setenv("UNBOUND_HOST", "tcp://unbound-3:8953")
+	t.Setenv("DEFAULT_TTL", "900")
+	t.Setenv("DRY_RUN", "false")
+	config, err = Load(path)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"tcp://unbound-3:8953"}, config.Unbound.Host)
+	assert.Equal(t, 900, config.Unbound.DefaultTTL)
+	assert.False(t, config.Unbound.DryRun)
+	assert.Equal(t, "tolerate", config.Unbound.FailurePolicy)
+	assert.Equal(t, uint16(9999), config.Server.WebhookPort)
+}
+
+func TestLoadEmptyFile(t *testing.T) {
+	t.Setenv("UNBOUND_HOST", "tcp://unbound:8953")
+
+	config, err := Load(writeConfig(t, ""))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"tcp://unbound:8953"}, config.Unbound.Host)
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		env      map[string]string
+		expected []string
+	}{
+		{
+			name:     "missing host",
+			content:  "dry_run: true",
+			expected: []string{"at least one Unbound host is required"},
+		},
+		{
+			name: "unknown keys",
+			content: `
+unbound_host: [tcp://unbound:8953]
+unbound_hosts: [tcp://unbound:8953]
+webhook_prot: 9999
+`,
+			expected: []string{
+				"line 3: field unbound_hosts not found",
+				"line 4: field webhook_prot not found",
+			},
+		},
+		{
+			name: "invalid values",
+			content: `
+unbound_host: [tcp://unbound:8953]
+default_ttl: ten
+unbound_failure_policy: sometimes
+unbound_bulk_size: -1
+readiness_probe_interval: 0
+`,
+			expected: []string{
+				"line 3: cannot unmarshal !!str `ten` into int",
+				`unknown failure policy "sometimes"`,
+				"bulk size must not be negative, got -1",
+				"readiness probe interval must be positive, got 0",
+			},
+		},
+		{
+			name:    "invalid environment variable",
+			content: "unbound_host: [tcp://unbound:8953]",
+			env:     map[string]string{"WEBHOOK_PORT": "port", "UNBOUND_RETRY_ATTEMPTS": "-1"},
+			expected: []string{
+				"invalid WEBHOOK_PORT",
+				"retry attempts must not be negative, got -1",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			config, err := Load(writeConfig(t, tt.content))
+			assert.Nil(t, config)
+			for _, expected := range tt.expected {
+				assert.ErrorContains(t, err, expected)
+			}
+		})
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	t.Setenv("UNBOUND_HOST", "tcp://unbound:8953")
+
+	config, err := Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Nil(t, config)
+	assert.ErrorContains(t, err, "could not read the configuration file")
+}
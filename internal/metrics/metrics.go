@@ -0,0 +1,129 @@
+// Package metrics contains the Prometheus metrics of the webhook.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"time"
+)
+
+const namespace = "external_dns_unbound"
+
+var (
+	// ProviderCalls counts the calls to the provider by method and status.
+	ProviderCalls = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "provider_calls_total",
+		Help:      "Number of calls to the provider by method and status.",
+	}, []string{"method", "status"})
+
+	// ProviderCallDuration measures the duration of the calls to the provider.
+	ProviderCallDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "provider_call_duration_seconds",
+		Help:      "Duration of the calls to the provider by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	// RecordChanges counts the record changes applied by action.
+	RecordChanges = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "record_changes_total",
+		Help:      "Number of record changes applied by action.",
+	}, []string{"action"})
+
+	// ControlErrors counts the failed commands sent to the Unbound control
+	// channel.
+	ControlErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "control_errors_total",
+		Help:      "Number of failed commands on the Unbound control channel by instance and command.",
+	}, []string{"instance", "command"})
+
+	// ControlDuration measures the duration of the commands sent to the Unbound
+	// control channel.
+	ControlDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "control_duration_seconds",
+		Help:      "Duration of the commands on the Unbound control channel by instance and command.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"instance", "command"})
+
+	// ControlRetries counts the commands retried after a transient error on
+	// the Unbound control channel.
+	ControlRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "control_retries_total",
+		Help:      "Number of retried commands on the Unbound control channel by instance and command.",
+	}, []string{"instance", "command"})
+
+	// CertificateReloads counts the reloads of the TLS files of the control
+	// channel.
+	CertificateReloads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "certificate_reloads_total",
+		Help:      "Number of reloads of the TLS files of the Unbound control channel by instance and status.",
+	}, []string{"instance", "status"})
+
+	// ManagedRecords is the number of managed records by type and domain.
+	ManagedRecords = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "managed_records",
+		Help:      "Number of managed records by type and domain.",
+	}, []string{"type", "domain"})
+
+	// DivergentRecords is the number of records missing on an instance
+	// compared to the other instances.
+	DivergentRecords = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "divergent_records",
+		Help:      "Number of records missing on an instance compared to the other instances.",
+	}, []string{"instance"})
+
+	// SnapshotAge is the age of the oldest cached records of an instance.
+	SnapshotAge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "snapshot_age_seconds",
+		Help:      "Age of the oldest cached records of an instance.",
+	}, []string{"instance"})
+
+	// Repairs counts the names repaired by the reconciliation.
+	Repairs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "repairs_total",
+		Help:      "Number of names repaired by the reconciliation by instance and status.",
+	}, []string{"instance", "status"})
+
+	// LastSync is the timestamp of the last successful synchronization.
+	LastSync = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_sync_timestamp_seconds",
+		Help:      "Timestamp of the last successful synchronization with ExternalDNS.",
+	})
+)
+
+// Status returns the status label of an operation.
+func Status(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
+
+// ObserveProviderCall records a call to the provider started at start.
+func ObserveProviderCall(method string, start time.Time, err error) {
+	ProviderCalls.WithLabelValues(method, Status(err)).Inc()
+	ProviderCallDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err == nil && method != "AdjustEndpoints" {
+		LastSync.SetToCurrentTime()
+	}
+}
+
+// ObserveControl records a command sent to the Unbound control channel of an
+// instance started at start.
+func ObserveControl(instance, command string, start time.Time, err error) {
+	ControlDuration.WithLabelValues(instance, command).Observe(time.Since(start).Seconds())
+	if err != nil {
+		ControlErrors.WithLabelValues(instance, command).Inc()
+	}
+}
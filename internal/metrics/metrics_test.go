@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// sampleCount returns the number of observations of a histogram.
+func sampleCount(t *testing.T, observer prometheus.Observer) uint64 {
+	m := &dto.Metric{}
+	if err := observer.(prometheus.Metric).Write(m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestObserveProviderCall(t *testing.T) {
+	// The metrics are global, only their changes are checked
+	records := testutil.ToFloat64(ProviderCalls.WithLabelValues("Records", "success"))
+	applyChanges := testutil.ToFloat64(ProviderCalls.WithLabelValues("ApplyChanges", "error"))
+	adjustEndpoints := testutil.ToFloat64(ProviderCalls.WithLabelValues("AdjustEndpoints", "success"))
+	LastSync.Set(0)
+
+	ObserveProviderCall("Records", time.Now(), nil)
+	assert.Equal(t, records+1, testutil.ToFloat64(ProviderCalls.WithLabelValues("Records", "success")))
+	assert.NotZero(t, testutil.ToFloat64(LastSync))
+
+	LastSync.Set(0)
+	ObserveProviderCall("ApplyChanges", time.Now(), errors.New("failed"))
+	assert.Equal(t, applyChanges+1, testutil.ToFloat64(ProviderCalls.WithLabelValues("ApplyChanges", "error")))
+	assert.Zero(t, testutil.ToFloat64(LastSync))
+
+	ObserveProviderCall("AdjustEndpoints", time.Now(), nil)
+	assert.Equal(t, adjustEndpoints+1, testutil.ToFloat64(ProviderCalls.WithLabelValues("AdjustEndpoints", "success")))
+	assert.Zero(t, testutil.ToFloat64(LastSync))
+}
+
+func TestObserveControl(t *testing.T) {
+	errs := testutil.ToFloat64(ControlErrors.WithLabelValues("unbound", "local_data"))
+	observations := sampleCount(t, ControlDuration.WithLabelValues("unbound", "local_data"))
+
+	ObserveControl("unbound", "local_data", time.Now(), nil)
+	assert.Equal(t, errs, testutil.ToFloat64(ControlErrors.WithLabelValues("unbound", "local_data")))
+
+	ObserveControl("unbound", "local_data", time.Now(), errors.New("failed"))
+	assert.Equal(t, errs+1, testutil.ToFloat64(ControlErrors.WithLabelValues("unbound", "local_data")))
+	assert.Equal(t, observations+2, sampleCount(t, ControlDuration.WithLabelValues("unbound", "local_data")))
+}
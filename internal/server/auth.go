@@ -0,0 +1,31 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// authenticate requires the bearer token on the requests to the handler. The
+// handler is returned as is if there is no token.
+func authenticate(next http.Handler, token string) http.Handler {
+	if token == "" {
+		return next
+	}
+
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(req.Header.Get("Authorization")), expected) != 1 {
+			log.WithFields(log.Fields{
+				"method": req.Method,
+				"path":   req.URL.Path,
+				"remote": req.RemoteAddr,
+			}).Warn("Rejected a request without a valid bearer token.")
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthenticate(t *testing.T) {
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		expected      int
+	}{
+		{
+			name:     "no token",
+			expected: http.StatusOK,
+		},
+		{
+			name:          "valid token",
+			token:         "secret",
+			authorization: "Bearer secret",
+			expected:      http.StatusOK,
+		},
+		{
+			name:     "missing token",
+			token:    "secret",
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name:          "invalid token",
+			token:         "secret",
+			authorization: "Bearer other",
+			expected:      http.StatusUnauthorized,
+		},
+		{
+			name:          "token without scheme",
+			token:         "secret",
+			authorization: "secret",
+			expected:      http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := authenticate(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}), tt.token)
+
+			req := httptest.NewRequest(http.MethodGet, "/records", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expected, rec.Code)
+			if tt.expected == http.StatusUnauthorized {
+				assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
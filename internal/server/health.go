@@ -1,10 +1,13 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"net"
 	"net/http"
 	"sync"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -13,6 +16,7 @@ type HealthStatus struct {
 	m       sync.Mutex
 	healthy bool
 	ready   bool
+	reason  string
 }
 
 // SetHealth sets the health status.
@@ -26,6 +30,15 @@ func (h *HealthStatus) SetHealth(v bool) {
 func (h *HealthStatus) SetReady(v bool) {
 	h.m.Lock()
 	h.ready = v
+	h.reason = ""
+	h.m.Unlock()
+}
+
+// SetNotReady unsets the readiness status and explains why.
+func (h *HealthStatus) SetNotReady(reason string) {
+	h.m.Lock()
+	h.ready = false
+	h.reason = reason
 	h.m.Unlock()
 }
 
@@ -47,6 +60,15 @@ func (h *HealthStatus) IsReady() bool {
 	return ready
 }
 
+// NotReadyReason returns why the webhook is not ready, if known.
+func (h *HealthStatus) NotReadyReason() string {
+	var reason string
+	h.m.Lock()
+	reason = h.reason
+	h.m.Unlock()
+	return reason
+}
+
 // HealthServer is the liveness and readiness server.
 type HealthServer struct {
 	status *HealthStatus
@@ -70,22 +92,27 @@ func (s HealthServer) livenessHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // readinessHandler checks if the server is ready. It writes 200/OK if the
-// healthy flag is set to "true" and 503/Service Unavailable otherwise.
+// ready flag is set to "true" and 503/Service Unavailable otherwise, followed
+// by the reason why the webhook is not ready if known.
 func (s HealthServer) readinessHandler(w http.ResponseWriter, r *http.Request) {
 	ready := s.status.IsReady()
 	var err error
 	if ready {
 		_, err = w.Write([]byte(http.StatusText(http.StatusOK)))
 	} else {
+		body := http.StatusText(http.StatusServiceUnavailable)
+		if reason := s.status.NotReadyReason(); reason != "" {
+			body += ": " + reason
+		}
 		w.WriteHeader(http.StatusServiceUnavailable)
-		_, err = w.Write([]byte(http.StatusText(http.StatusServiceUnavailable)))
+		_, err = w.Write([]byte(body))
 	}
 	if err != nil {
 		log.Warn("Could not answer to a readiness probe: ", err.Error())
 	}
 }
 
-// Start starts the liveness and readiness server.
+// Start starts the liveness, readiness and metrics server.
 func (s *HealthServer) Start(status *HealthStatus, startedChan chan struct{}, options ServerOptions) {
 	s.status = status
 
@@ -94,6 +121,7 @@ func (s *HealthServer) Start(status *HealthStatus, startedChan chan struct{}, op
 	mux.HandleFunc("/", s.readinessHandler)
 	mux.HandleFunc("/ready", s.readinessHandler)
 	mux.HandleFunc("/health", s.livenessHandler)
+	mux.Handle("/metrics", promhttp.Handler())
 
 	address := options.GetHealthAddress()
 
@@ -113,7 +141,16 @@ func (s *HealthServer) Start(status *HealthStatus, startedChan chan struct{}, op
 		startedChan <- struct{}{}
 	}
 
-	if err := s.srv.Serve(l); err != nil {
+	if err := s.srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatal(err)
 	}
 }
+
+// Shutdown stops the liveness, readiness and metrics server, waiting for the
+// in-flight requests to finish until the context is done.
+func (s *HealthServer) Shutdown(ctx context.Context) error {
+	if s.srv == nil {
+		return nil
+	}
+	return s.srv.Shutdown(ctx)
+}
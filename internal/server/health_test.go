@@ -3,6 +3,7 @@ package server
 import (
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"io"
 	"net"
 	"net/http"
 	"testing"
@@ -139,4 +140,40 @@ func TestHealthServer(t *testing.T) {
 	res, err = http.Get(url + "/health")
 	assert.Nil(t, err)
 	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	status.SetNotReady("unbound instance is not reachable")
+	res, err = http.Get(url + "/ready")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	body, err := io.ReadAll(res.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "Service Unavailable: unbound instance is not reachable", string(body))
+}
+
+func TestHealthServerMetrics(t *testing.T) {
+	srv := &HealthServer{}
+	status := &HealthStatus{}
+	startedChan := make(chan struct{}, 1)
+
+	port, err := getFreePort()
+	if err != nil {
+		t.Fatal("Cannot find free port for test")
+	}
+
+	options := ServerOptions{
+		HealthHost:   "127.0.0.1",
+		HealthPort:   uint16(port),
+		ReadTimeout:  60000,
+		WriteTimeout: 60000,
+	}
+
+	go srv.Start(status, startedChan, options)
+	<-startedChan
+
+	res, err := http.Get(fmt.Sprintf("http://%s/metrics", options.GetHealthAddress()))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	body, err := io.ReadAll(res.Body)
+	assert.Nil(t, err)
+	assert.Contains(t, string(body), "go_goroutines")
 }
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"time"
 )
@@ -9,17 +10,64 @@ import (
 // influence the server.
 type ServerOptions struct {
 	// Webhook host
-	WebhookHost string `env:"WEBHOOK_HOST" default:"localhost"`
+	WebhookHost string `env:"WEBHOOK_HOST" default:"localhost" yaml:"webhook_host"`
 	// Webhook port
-	WebhookPort uint16 `env:"WEBHOOK_PORT" default:"8888"`
+	WebhookPort uint16 `env:"WEBHOOK_PORT" default:"8888" yaml:"webhook_port"`
 	// Readiness and liveness probe host
-	HealthHost string `env:"HEALTH_HOST" default:"0.0.0.0"`
+	HealthHost string `env:"HEALTH_HOST" default:"0.0.0.0" yaml:"health_host"`
 	// Readiness and liveness probe port
-	HealthPort uint16 `env:"HEALTH_PORT" default:"8080"`
+	HealthPort uint16 `env:"HEALTH_PORT" default:"8080" yaml:"health_port"`
 	// Read timeout in milliseconds
-	ReadTimeout int `env:"READ_TIMEOUT" default:"60000"`
+	ReadTimeout int `env:"READ_TIMEOUT" default:"60000" yaml:"read_timeout"`
 	// Write timeout in milliseconds
-	WriteTimeout int `env:"WRITE_TIMEOUT" default:"60000"`
+	WriteTimeout int `env:"WRITE_TIMEOUT" default:"60000" yaml:"write_timeout"`
+	// Interval between two readiness probes in milliseconds
+	ReadinessProbeInterval int `env:"READINESS_PROBE_INTERVAL" default:"10000" yaml:"readiness_probe_interval"`
+	// Number of consecutive failed probes before the webhook is not ready
+	ReadinessFailureThreshold int `env:"READINESS_FAILURE_THRESHOLD" default:"3" yaml:"readiness_failure_threshold"`
+	// Maximum duration of the shutdown in milliseconds
+	ShutdownTimeout int `env:"SHUTDOWN_TIMEOUT" default:"30000" yaml:"shutdown_timeout"`
+	// Certificate and private key of the webhook, served on plain HTTP if
+	// empty
+	WebhookTLSCertPath string `env:"WEBHOOK_TLS_CERT_PATH" default:"" yaml:"webhook_tls_cert_path"`
+	WebhookTLSKeyPath  string `env:"WEBHOOK_TLS_KEY_PATH" default:"" yaml:"webhook_tls_key_path"`
+	// CA the client certificates of the webhook are verified against, client
+	// certificates are not required if empty
+	WebhookTLSClientCAPath string `env:"WEBHOOK_TLS_CLIENT_CA_PATH" default:"" yaml:"webhook_tls_client_ca_path"`
+	// Bearer token required on the requests to the webhook, if any
+	WebhookBearerToken string `env:"WEBHOOK_BEARER_TOKEN" default:"" yaml:"webhook_bearer_token"`
+}
+
+// Validate checks the options, and reports all the invalid settings at once,
+// named after their environment variables.
+func (o ServerOptions) Validate() error {
+	var errs []error
+	for _, timeout := range []struct {
+		setting string
+		name    string
+		value   int
+	}{
+		{setting: "READ_TIMEOUT", name: "read timeout", value: o.ReadTimeout},
+		{setting: "WRITE_TIMEOUT", name: "write timeout", value: o.WriteTimeout},
+		{setting: "SHUTDOWN_TIMEOUT", name: "shutdown timeout", value: o.ShutdownTimeout},
+	} {
+		if timeout.value < 0 {
+			errs = append(errs, fmt.Errorf("%s: %s must not be negative, got %d", timeout.setting, timeout.name, timeout.value))
+		}
+	}
+
+	if o.ReadinessProbeInterval <= 0 {
+		errs = append(errs, fmt.Errorf("READINESS_PROBE_INTERVAL: readiness probe interval must be positive, got %d", o.ReadinessProbeInterval))
+	}
+
+	if (o.WebhookTLSCertPath == "") != (o.WebhookTLSKeyPath == "") {
+		errs = append(errs, errors.New("WEBHOOK_TLS_CERT_PATH: the certificate and the private key of the webhook must be set together"))
+	}
+	if o.WebhookTLSClientCAPath != "" && o.WebhookTLSCertPath == "" {
+		errs = append(errs, errors.New("WEBHOOK_TLS_CLIENT_CA_PATH: the client CA of the webhook requires its certificate and private key"))
+	}
+
+	return errors.Join(errs...)
 }
 
 // GetWebhookAddress returns the webhook address as "host:port".
@@ -42,3 +90,13 @@ func (o ServerOptions) GetReadTimeout() time.Duration {
 func (o ServerOptions) GetWriteTimeout() time.Duration {
 	return time.Duration(o.WriteTimeout) * time.Millisecond
 }
+
+// GetReadinessProbeInterval returns the interval between two readiness probes.
+func (o ServerOptions) GetReadinessProbeInterval() time.Duration {
+	return time.Duration(o.ReadinessProbeInterval) * time.Millisecond
+}
+
+// GetShutdownTimeout returns the maximum duration of the shutdown.
+func (o ServerOptions) GetShutdownTimeout() time.Duration {
+	return time.Duration(o.ShutdownTimeout) * time.Millisecond
+}
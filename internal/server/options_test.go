@@ -25,6 +25,15 @@ func TestDefault(t *testing.T) {
 	assert.Equal(t, 60000*time.Millisecond, options.GetReadTimeout())
 	assert.Equal(t, 60000, options.WriteTimeout, 60000)
 	assert.Equal(t, 60000*time.Millisecond, options.GetWriteTimeout())
+
+	assert.Equal(t, 10000, options.ReadinessProbeInterval)
+	assert.Equal(t, 10000*time.Millisecond, options.GetReadinessProbeInterval())
+	assert.Equal(t, 3, options.ReadinessFailureThreshold)
+
+	assert.Equal(t, "", options.WebhookTLSCertPath)
+	assert.Equal(t, "", options.WebhookTLSKeyPath)
+	assert.Equal(t, "", options.WebhookTLSClientCAPath)
+	assert.Equal(t, "", options.WebhookBearerToken)
 }
 
 func TestSetting(t *testing.T) {
@@ -42,3 +51,23 @@ func TestSetting(t *testing.T) {
 	assert.Equal(t, 1011*time.Millisecond, options.GetReadTimeout())
 	assert.Equal(t, 1213*time.Millisecond, options.GetWriteTimeout())
 }
+
+func TestValidate(t *testing.T) {
+	options := &ServerOptions{}
+	if err := env.Set(options); err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, options.Validate())
+
+	options.ReadTimeout = -1
+	options.ShutdownTimeout = -2
+	options.ReadinessProbeInterval = 0
+	options.WebhookTLSKeyPath = "key.pem"
+	options.WebhookTLSClientCAPath = "ca.pem"
+	err := options.Validate()
+	assert.ErrorContains(t, err, "read timeout must not be negative, got -1")
+	assert.ErrorContains(t, err, "shutdown timeout must not be negative, got -2")
+	assert.ErrorContains(t, err, "readiness probe interval must be positive, got 0")
+	assert.ErrorContains(t, err, "the certificate and the private key of the webhook must be set together")
+	assert.ErrorContains(t, err, "the client CA of the webhook requires its certificate and private key")
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Checker checks that the webhook is able to serve requests.
+type Checker interface {
+	Check() error
+}
+
+// ReadinessProbe periodically checks the webhook and sets its readiness
+// status accordingly.
+type ReadinessProbe struct {
+	checker          Checker
+	interval         time.Duration
+	failureThreshold int
+	failures         int
+}
+
+// NewReadinessProbe creates a readiness probe from the server options.
+func NewReadinessProbe(checker Checker, options ServerOptions) *ReadinessProbe {
+	return &ReadinessProbe{
+		checker:          checker,
+		interval:         options.GetReadinessProbeInterval(),
+		failureThreshold: max(options.ReadinessFailureThreshold, 1),
+	}
+}
+
+// Run probes the webhook right away and then every interval, until the
+// context is done.
+func (p *ReadinessProbe) Run(ctx context.Context, status *HealthStatus) {
+	p.probe(status)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.probe(status)
+		}
+	}
+}
+
+// probe checks the webhook once. The webhook becomes ready as soon as a check
+// succeeds, and is not ready anymore after failureThreshold consecutive
+// failed checks. It is not ready until the first check succeeds.
+func (p *ReadinessProbe) probe(status *HealthStatus) {
+	err := p.checker.Check()
+	if err == nil {
+		if !status.IsReady() {
+			log.Info("Readiness probe succeeded, the webhook is ready")
+		}
+		p.failures = 0
+		status.SetReady(true)
+		return
+	}
+
+	p.failures++
+	log.Warnf("Readiness probe failed (%d/%d): %v", p.failures, p.failureThreshold, err)
+	if p.failures >= p.failureThreshold || !status.IsReady() {
+		status.SetNotReady(err.Error())
+	}
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+type mockChecker struct {
+	m   sync.Mutex
+	err error
+}
+
+func (c *mockChecker) Check() error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.err
+}
+
+func (c *mockChecker) setErr(err error) {
+	c.m.Lock()
+	c.err = err
+	c.m.Unlock()
+}
+
+func TestReadinessProbe(t *testing.T) {
+	checker := &mockChecker{err: errors.New("connection refused")}
+	status := &HealthStatus{}
+	probe := NewReadinessProbe(checker, ServerOptions{ReadinessFailureThreshold: 2})
+
+	// Not ready until the first successful check
+	probe.probe(status)
+	assert.False(t, status.IsReady())
+	assert.Equal(t, "connection refused", status.NotReadyReason())
+
+	checker.setErr(nil)
+	probe.probe(status)
+	assert.True(t, status.IsReady())
+	assert.Empty(t, status.NotReadyReason())
+
+	// Still ready until the threshold is reached
+	checker.setErr(errors.New("certificate signed by unknown authority"))
+	probe.probe(status)
+	assert.True(t, status.IsReady())
+	probe.probe(status)
+	assert.False(t, status.IsReady())
+	assert.Equal(t, "certificate signed by unknown authority", status.NotReadyReason())
+
+	checker.setErr(nil)
+	probe.probe(status)
+	assert.True(t, status.IsReady())
+}
+
+func TestReadinessProbeRun(t *testing.T) {
+	checker := &mockChecker{err: errors.New("connection refused")}
+	status := &HealthStatus{}
+	probe := NewReadinessProbe(checker, ServerOptions{ReadinessProbeInterval: 10, ReadinessFailureThreshold: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		probe.Run(ctx, status)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool { return status.NotReadyReason() != "" }, time.Second, 5*time.Millisecond)
+	checker.setErr(nil)
+	assert.Eventually(t, status.IsReady, time.Second, 5*time.Millisecond)
+
+	cancel()
+	<-done
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// webhookTLSConfig returns the TLS configuration of the webhook server, nil
+// if it is served on plain HTTP. With a client CA, the clients must present a
+// certificate issued by it.
+func webhookTLSConfig(options ServerOptions) (*tls.Config, error) {
+	if options.WebhookTLSCertPath == "" && options.WebhookTLSKeyPath == "" {
+		if options.WebhookTLSClientCAPath != "" {
+			return nil, errors.New("the client CA of the webhook requires its certificate and private key")
+		}
+		return nil, nil
+	}
+
+	certificate, err := tls.LoadX509KeyPair(options.WebhookTLSCertPath, options.WebhookTLSKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not load the certificate of the webhook: %w", err)
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if options.WebhookTLSClientCAPath != "" {
+		content, err := os.ReadFile(options.WebhookTLSClientCAPath)
+		if err != nil {
+			return nil, fmt.Errorf("could not read the client CA of the webhook: %w", err)
+		}
+		clientCAs := x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(content) {
+			return nil, fmt.Errorf("no certificate found in the client CA of the webhook %s", options.WebhookTLSClientCAPath)
+		}
+		config.ClientCAs = clientCAs
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
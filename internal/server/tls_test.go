@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/guillomep/external-dns-unbound-webhook/internal/testca"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestWebhookTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca := testca.New(t, "ca")
+	caPath := ca.Write(t, dir)
+	certPath, keyPath := ca.WriteIssued(t, dir, "localhost")
+	invalidPath := filepath.Join(dir, "invalid.pem")
+	testca.WriteFile(t, invalidPath, []byte("invalid"))
+
+	tests := []struct {
+		name        string
+		options     ServerOptions
+		expectedErr string
+		tls         bool
+		clientAuth  tls.ClientAuthType
+	}{
+		{
+			name: "plain HTTP",
+		},
+		{
+			name:    "server TLS",
+			options: ServerOptions{WebhookTLSCertPath: certPath, WebhookTLSKeyPath: keyPath},
+			tls:     true,
+		},
+		{
+			name:       "mutual TLS",
+			options:    ServerOptions{WebhookTLSCertPath: certPath, WebhookTLSKeyPath: keyPath, WebhookTLSClientCAPath: caPath},
+			tls:        true,
+			clientAuth: tls.RequireAndVerifyClientCert,
+		},
+		{
+			name:        "missing private key",
+			options:     ServerOptions{WebhookTLSCertPath: certPath},
+			expectedErr: "could not load the certificate of the webhook",
+		},
+		{
+			name:        "client CA without certificate",
+			options:     ServerOptions{WebhookTLSClientCAPath: caPath},
+			expectedErr: "the client CA of the webhook requires its certificate and private key",
+		},
+		{
+			name:        "missing client CA",
+			options:     ServerOptions{WebhookTLSCertPath: certPath, WebhookTLSKeyPath: keyPath, WebhookTLSClientCAPath: filepath.Join(dir, "missing.pem")},
+			expectedErr: "could not read the client CA of the webhook",
+		},
+		{
+			name:        "invalid client CA",
+			options:     ServerOptions{WebhookTLSCertPath: certPath, WebhookTLSKeyPath: keyPath, WebhookTLSClientCAPath: invalidPath},
+			expectedErr: "no certificate found in the client CA of the webhook",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := webhookTLSConfig(tt.options)
+			if tt.expectedErr != "" {
+				assert.ErrorContains(t, err, tt.expectedErr)
+				return
+			}
+			assert.Nil(t, err)
+			if !tt.tls {
+				assert.Nil(t, config)
+				return
+			}
+			assert.Len(t, config.Certificates, 1)
+			assert.Equal(t, tt.clientAuth, config.ClientAuth)
+		})
+	}
+}
+
+func TestWebhookServerTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := testca.New(t, "ca")
+	caPath := ca.Write(t, dir)
+	certPath, keyPath := ca.WriteIssued(t, dir, "localhost")
+	clientCertPath, clientKeyPath := ca.WriteIssued(t, dir, "external-dns")
+
+	port, err := getFreePort()
+	if err != nil {
+		t.Fatal("Cannot find free port for test")
+	}
+
+	options := ServerOptions{
+		WebhookHost:            "localhost",
+		WebhookPort:            uint16(port),
+		ReadTimeout:            60000,
+		WriteTimeout:           60000,
+		WebhookTLSCertPath:     certPath,
+		WebhookTLSKeyPath:      keyPath,
+		WebhookTLSClientCAPath: caPath,
+		WebhookBearerToken:     "secret",
+	}
+
+	srv := &WebhookServer{}
+	startedChan := make(chan struct{}, 1)
+	go srv.Start(&mockProvider{}, startedChan, options)
+	<-startedChan
+	defer srv.Shutdown(context.Background())
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(ca.Cert)
+	clientCert, err := tls.LoadX509KeyPair(clientCertPath, clientKeyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newClient := func(certificates ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      rootCAs,
+			Certificates: certificates,
+		}}}
+	}
+	get := func(client *http.Client, token string) (*http.Response, error) {
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://%s/records", options.GetWebhookAddress()), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res, err := client.Do(req)
+		if err == nil {
+			res.Body.Close()
+		}
+		return res, err
+	}
+
+	// An authenticated client is served
+	res, err := get(newClient(clientCert), "secret")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	// A client without the token is rejected
+	res, err = get(newClient(clientCert), "")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	// A client without certificate is rejected during the handshake
+	_, err = get(newClient(), "secret")
+	assert.NotNil(t, err)
+
+	// Plain HTTP is not served
+	res, err = http.Get(fmt.Sprintf("http://%s/records", options.GetWebhookAddress()))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	res.Body.Close()
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/plan"
+	"sigs.k8s.io/external-dns/provider"
+	"sigs.k8s.io/external-dns/provider/webhook/api"
+)
+
+// WebhookServer is the server of the ExternalDNS webhook API.
+type WebhookServer struct {
+	srv *http.Server
+}
+
+// Start starts the webhook server for the provider.
+func (s *WebhookServer) Start(provider provider.Provider, startedChan chan struct{}, options ServerOptions) {
+	p := api.WebhookServer{Provider: provider}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/", p.NegotiateHandler)
+	mux.HandleFunc(api.UrlRecords, recordsHandler(provider))
+	mux.HandleFunc(api.UrlAdjustEndpoints, p.AdjustEndpointsHandler)
+
+	address := options.GetWebhookAddress()
+
+	tlsConfig, err := webhookTLSConfig(options)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s.srv = &http.Server{
+		Addr:         address,
+		Handler:      authenticate(mux, options.WebhookBearerToken),
+		ReadTimeout:  options.GetReadTimeout(),
+		WriteTimeout: options.GetWriteTimeout(),
+	}
+
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if tlsConfig != nil {
+		l = tls.NewListener(l, tlsConfig)
+	}
+
+	if startedChan != nil {
+		startedChan <- struct{}{}
+	}
+
+	if err := s.srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
+
+// recordsHandler serves the records of the provider and applies the changes
+// like the handler of the webhook API, but passes the context of the request
+// to the provider, so an abandoned request stops sending commands to Unbound.
+func recordsHandler(provider provider.Provider) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+			records, err := provider.Records(req.Context())
+			if err != nil {
+				log.Errorf("Failed to get Records: %v", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set(api.ContentTypeHeader, api.MediaTypeFormatAndVersion)
+			w.WriteHeader(http.StatusOK)
+			if err := json.NewEncoder(w).Encode(records); err != nil {
+				log.Errorf("Failed to encode records: %v", err)
+			}
+		case http.MethodPost:
+			var changes plan.Changes
+			if err := json.NewDecoder(req.Body).Decode(&changes); err != nil {
+				log.Errorf("Failed to decode changes: %v", err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if err := provider.ApplyChanges(req.Context(), &changes); err != nil {
+				log.Errorf("Failed to apply changes: %v", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			log.Errorf("Unsupported method %s", req.Method)
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}
+}
+
+// Shutdown stops accepting new requests and waits for the in-flight ones to
+// finish, until the context is done.
+func (s *WebhookServer) Shutdown(ctx context.Context) error {
+	if s.srv == nil {
+		return nil
+	}
+	return s.srv.Shutdown(ctx)
+}
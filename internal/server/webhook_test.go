@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+	"sigs.k8s.io/external-dns/provider"
+	"strings"
+	"testing"
+)
+
+type mockProvider struct {
+	provider.BaseProvider
+}
+
+func (p *mockProvider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
+	return []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("test.lan", "A", endpoint.TTL(300), "192.168.1.1"),
+	}, nil
+}
+
+func (p *mockProvider) ApplyChanges(ctx context.Context, changes *plan.Changes) error {
+	return nil
+}
+
+func TestWebhookServer(t *testing.T) {
+	srv := &WebhookServer{}
+	startedChan := make(chan struct{}, 1)
+
+	port, err := getFreePort()
+	if err != nil {
+		t.Fatal("Cannot find free port for test")
+	}
+
+	options := ServerOptions{
+		WebhookHost:  "127.0.0.1",
+		WebhookPort:  uint16(port),
+		ReadTimeout:  60000,
+		WriteTimeout: 60000,
+	}
+
+	go srv.Start(&mockProvider{}, startedChan, options)
+	<-startedChan
+
+	url := fmt.Sprintf("http://%s", options.GetWebhookAddress())
+
+	res, err := http.Get(url + "/records")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	body, err := io.ReadAll(res.Body)
+	assert.Nil(t, err)
+	assert.Contains(t, string(body), "test.lan")
+
+	assert.Nil(t, srv.Shutdown(context.Background()))
+
+	_, err = http.Get(url + "/records")
+	assert.NotNil(t, err)
+}
+
+// contextProvider fails the requests whose context is done.
+type contextProvider struct {
+	mockProvider
+}
+
+func (p *contextProvider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return p.mockProvider.Records(ctx)
+}
+
+func (p *contextProvider) ApplyChanges(ctx context.Context, changes *plan.Changes) error {
+	return ctx.Err()
+}
+
+func TestRecordsHandler(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		ctx    context.Context
+		status int
+	}{
+		{name: "records", method: http.MethodGet, ctx: context.Background(), status: http.StatusOK},
+		{name: "abandoned records", method: http.MethodGet, ctx: canceled, status: http.StatusInternalServerError},
+		{name: "changes", method: http.MethodPost, body: `{"Create":[]}`, ctx: context.Background(), status: http.StatusNoContent},
+		{name: "abandoned changes", method: http.MethodPost, body: `{"Create":[]}`, ctx: canceled, status: http.StatusInternalServerError},
+		{name: "invalid changes", method: http.MethodPost, body: `{`, ctx: context.Background(), status: http.StatusBadRequest},
+		{name: "unsupported method", method: http.MethodPut, ctx: context.Background(), status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequestWithContext(tt.ctx, tt.method, "/records", strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+
+			recordsHandler(&contextProvider{}).ServeHTTP(rec, req)
+			assert.Equal(t, tt.status, rec.Code)
+		})
+	}
+}
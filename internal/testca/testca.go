@@ -0,0 +1,145 @@
+// Package testca issues the certificates of the tests of the TLS connections,
+// between ExternalDNS and the webhook or between the webhook and Unbound.
+package testca
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// CA is a certificate authority valid for an hour.
+type CA struct {
+	Cert *x509.Certificate
+	key  crypto.Signer
+	// rsaKeys is true if the CA issues RSA keys instead of ECDSA ones.
+	rsaKeys bool
+}
+
+// New returns a new CA issuing ECDSA keys.
+func New(t testing.TB, name string) *CA {
+	return newCA(t, name, false)
+}
+
+// NewRSA returns a new CA issuing RSA keys, the only private keys the Unbound
+// client library loads.
+func NewRSA(t testing.TB, name string) *CA {
+	return newCA(t, name, true)
+}
+
+func newCA(t testing.TB, name string, rsaKeys bool) *CA {
+	key := generateKey(t, rsaKeys)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &CA{Cert: cert, key: key, rsaKeys: rsaKeys}
+}
+
+// Issue returns the PEM certificate and private key of a new certificate for
+// the name, valid for both servers and clients.
+func (ca *CA) Issue(t testing.TB, name string) ([]byte, []byte) {
+	key := generateKey(t, ca.rsaKeys)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Cert, key.Public(), ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), encodeKey(t, key)
+}
+
+// WriteIssued writes a new certificate for the name and its private key in
+// the directory, and returns their paths.
+func (ca *CA) WriteIssued(t testing.TB, dir, name string) (string, string) {
+	certPEM, keyPEM := ca.Issue(t, name)
+	certPath := filepath.Join(dir, name+".pem")
+	keyPath := filepath.Join(dir, name+"-key.pem")
+	WriteFile(t, certPath, certPEM)
+	WriteFile(t, keyPath, keyPEM)
+	return certPath, keyPath
+}
+
+// PEM returns the PEM certificate of the CA.
+func (ca *CA) PEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Cert.Raw})
+}
+
+// Write writes the PEM certificate of the CA in the directory and returns its
+// path.
+func (ca *CA) Write(t testing.TB, dir string) string {
+	path := filepath.Join(dir, "ca.pem")
+	WriteFile(t, path, ca.PEM())
+	return path
+}
+
+// WriteFile writes a file of the test directory.
+func WriteFile(t testing.TB, path string, content []byte) {
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// generateKey returns a new RSA or ECDSA private key. ECDSA keys are much
+// faster to generate.
+func generateKey(t testing.TB, rsaKeys bool) crypto.Signer {
+	var (
+		key crypto.Signer
+		err error
+	)
+	if rsaKeys {
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	} else {
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// encodeKey returns the PEM private key.
+func encodeKey(t testing.TB, key crypto.Signer) []byte {
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	case *ecdsa.PrivateKey:
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	}
+	t.Fatalf("unsupported private key %T", key)
+	return nil
+}
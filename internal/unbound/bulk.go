@@ -0,0 +1,58 @@
+package unbound
+
+import (
+	"context"
+	unboundlib "github.com/guillomep/go-unbound"
+	"slices"
+)
+
+// setRecordsBulk replaces the records of the names, identified by their keys,
+// with bulk commands of at most bulkSize lines: the names holding records are
+// removed first, then all their desired records are added back.
+func (i *instance) setRecordsBulk(ctx context.Context, keys []string, snapshot, desired map[string][]unboundlib.RR) error {
+	views := []string{}
+	removed := map[string][]string{}
+	added := map[string][]unboundlib.RR{}
+	for _, key := range keys {
+		view, name := splitScopedName(key)
+		if !slices.Contains(views, view) {
+			views = append(views, view)
+		}
+		if len(snapshot[key]) > 0 {
+			removed[view] = append(removed[view], name)
+		}
+		added[view] = append(added[view], desired[key]...)
+	}
+
+	for _, view := range views {
+		for names := range slices.Chunk(removed[view], i.bulkSize) {
+			if err := i.removeLocalDatas(ctx, view, names); err != nil {
+				return err
+			}
+		}
+		for records := range slices.Chunk(added[view], i.bulkSize) {
+			if err := i.addLocalDatas(ctx, view, records); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addLocalDatas adds records to a view, or to the global local data, with a
+// single command.
+func (i *instance) addLocalDatas(ctx context.Context, view string, records []unboundlib.RR) error {
+	if view == "" {
+		return i.control(ctx).AddLocalDatas(records)
+	}
+	return i.control(ctx).AddViewLocalDatas(view, records)
+}
+
+// removeLocalDatas removes the records of names from a view, or from the
+// global local data, with a single command.
+func (i *instance) removeLocalDatas(ctx context.Context, view string, names []string) error {
+	if view == "" {
+		return i.control(ctx).RemoveLocalDatas(names)
+	}
+	return i.control(ctx).RemoveViewLocalDatas(view, names)
+}
@@ -0,0 +1,147 @@
+package unbound
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	unboundlib "github.com/guillomep/go-unbound"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+	"testing"
+	"time"
+)
+
+func TestApplyChangesBulk(t *testing.T) {
+	tests := []struct {
+		name     string
+		bulkSize int
+		commands int
+	}{
+		{name: "per record", bulkSize: 0, commands: 5},
+		{name: "chunks", bulkSize: 2, commands: 4},
+		{name: "single chunk", bulkSize: 100, commands: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mockClient{
+				records: []unboundlib.RR{
+					{Name: "a.test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+					{Name: "a.test.lan.", TTL: 300, Type: "TXT", Value: "\"owner\""},
+				},
+				views: map[string][]unboundlib.RR{"office": {}},
+			}
+			inst := &instance{host: "unbound-0", client: m, bulkSize: tt.bulkSize}
+			p := &UnboundProvider{instances: []*instance{inst}}
+
+			err := p.ApplyChanges(context.TODO(), &plan.Changes{
+				Create: []*endpoint.Endpoint{
+					endpoint.NewEndpointWithTTL("b.test.lan", "A", endpoint.TTL(300), "192.168.1.2", "192.168.1.3"),
+					endpoint.NewEndpointWithTTL("c.test.lan", "A", endpoint.TTL(300), "192.168.2.1").
+						WithProviderSpecific(PropertyView, "office"),
+				},
+				Delete: []*endpoint.Endpoint{
+					endpoint.NewEndpointWithTTL("a.test.lan", "A", endpoint.TTL(300), "192.168.1.1"),
+				},
+			})
+			assert.Nil(t, err)
+			assert.ElementsMatch(t, []unboundlib.RR{
+				{Name: "a.test.lan.", TTL: 300, Type: "TXT", Value: "\"owner\""},
+				{Name: "b.test.lan", TTL: 300, Type: "A", Value: "192.168.1.2"},
+				{Name: "b.test.lan", TTL: 300, Type: "A", Value: "192.168.1.3"},
+			}, m.records)
+			assert.Equal(t, []unboundlib.RR{
+				{Name: "c.test.lan", TTL: 300, Type: "A", Value: "192.168.2.1"},
+			}, m.views["office"])
+			assert.Equal(t, tt.commands, m.commands)
+		})
+	}
+}
+
+func TestApplyChangesBulkRollback(t *testing.T) {
+	records := []unboundlib.RR{
+		{Name: "a.test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+	}
+	failed := false
+	m := &mockClient{
+		records: append([]unboundlib.RR{}, records...),
+		failOn: func(action string, rr unboundlib.RR) error {
+			// Fail the bulk add, not the restoration
+			if action == actionCreate && rr.Value == "192.168.1.2" && !failed {
+				failed = true
+				return errors.New("add failed")
+			}
+			return nil
+		},
+	}
+	p := &UnboundProvider{instances: []*instance{{host: "unbound-0", client: m, bulkSize: 10}}}
+
+	err := p.ApplyChanges(context.TODO(), &plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("a.test.lan", "A", endpoint.TTL(300), "192.168.1.1"),
+		},
+		UpdateNew: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("a.test.lan", "A", endpoint.TTL(300), "192.168.1.2"),
+		},
+	})
+
+	var txErr *TransactionError
+	assert.ErrorAs(t, err, &txErr)
+	assert.Equal(t, []string{"a.test.lan"}, txErr.RolledBack)
+	assert.Equal(t, records, m.records)
+}
+
+// slowClient simulates the round trip of every command on the control
+// channel.
+type slowClient struct {
+	*mockClient
+	latency time.Duration
+}
+
+func (c *slowClient) ListLocalData() ([]unboundlib.RR, error) {
+	time.Sleep(c.latency)
+	return c.mockClient.ListLocalData()
+}
+
+func (c *slowClient) AddLocalData(rr unboundlib.RR) error {
+	time.Sleep(c.latency)
+	return c.mockClient.AddLocalData(rr)
+}
+
+func (c *slowClient) RemoveLocalData(rr unboundlib.RR) error {
+	time.Sleep(c.latency)
+	return c.mockClient.RemoveLocalData(rr)
+}
+
+func (c *slowClient) AddLocalDatas(records []unboundlib.RR) error {
+	time.Sleep(c.latency)
+	return c.mockClient.AddLocalDatas(records)
+}
+
+func (c *slowClient) RemoveLocalDatas(names []string) error {
+	time.Sleep(c.latency)
+	return c.mockClient.RemoveLocalDatas(names)
+}
+
+func BenchmarkSubmitChanges(b *testing.B) {
+	changes := []*UnboundChange{}
+	for i := range 1000 {
+		changes = append(changes, &UnboundChange{
+			Action: actionCreate,
+			RR:     &unboundlib.RR{Name: fmt.Sprintf("host-%d.test.lan", i), TTL: 300, Type: "A", Value: "192.168.1.1"},
+		})
+	}
+
+	for _, bulkSize := range []int{0, 100, 1000} {
+		b.Run(fmt.Sprintf("bulk size %d", bulkSize), func(b *testing.B) {
+			for b.Loop() {
+				client := &slowClient{mockClient: &mockClient{}, latency: 50 * time.Microsecond}
+				inst := &instance{host: "unbound-0", client: client, bulkSize: bulkSize}
+				if _, err := inst.submitChanges(context.TODO(), changes, map[string][]unboundlib.RR{}, map[string][]unboundlib.RR{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
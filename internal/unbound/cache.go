@@ -0,0 +1,81 @@
+package unbound
+
+import (
+	"context"
+	"github.com/guillomep/external-dns-unbound-webhook/internal/metrics"
+	unboundlib "github.com/guillomep/go-unbound"
+	"time"
+)
+
+// cachedView contains the records of a view of an instance, as of the last
+// dump, kept up to date with the changes applied since.
+type cachedView struct {
+	records []unboundlib.RR
+	dumped  time.Time
+}
+
+// cachedLocalData returns the records of the instance in a view, from the
+// cache if it is younger than the snapshot interval. Otherwise, the records
+// are dumped again and cached.
+func (i *instance) cachedLocalData(ctx context.Context, view string) ([]unboundlib.RR, error) {
+	if i.snapshotInterval <= 0 {
+		return i.localData(ctx, view)
+	}
+
+	if cached, ok := i.cache[view]; ok && time.Since(cached.dumped) < i.snapshotInterval {
+		return cached.records, nil
+	}
+
+	records, err := i.localData(ctx, view)
+	if err != nil {
+		delete(i.cache, view)
+		return nil, err
+	}
+	if i.cache == nil {
+		i.cache = map[string]*cachedView{}
+	}
+	i.cache[view] = &cachedView{records: records, dumped: time.Now()}
+	return records, nil
+}
+
+// updateCache replaces the cached records of the names modified by a
+// successful transaction with their desired records.
+func (i *instance) updateCache(tx *transaction) {
+	for _, key := range tx.modified {
+		view, name := splitScopedName(key)
+		cached, ok := i.cache[view]
+		if !ok {
+			continue
+		}
+
+		records := make([]unboundlib.RR, 0, len(cached.records))
+		for _, rr := range cached.records {
+			if canonicalName(rr.Name) != name {
+				records = append(records, rr)
+			}
+		}
+		cached.records = append(records, tx.desired[key]...)
+	}
+}
+
+// invalidateCache drops the cached records of the instance, they are dumped
+// again on the next read.
+func (i *instance) invalidateCache() {
+	i.cache = nil
+}
+
+// updateSnapshotAge updates the age of the oldest cached view of each
+// instance of the metrics.
+func (p *UnboundProvider) updateSnapshotAge() {
+	for _, inst := range p.instances {
+		if inst.snapshotInterval <= 0 {
+			continue
+		}
+
+		age := time.Duration(0)
+		for _, cached := range inst.cache {
+			age = max(age, time.Since(cached.dumped))
+		}
+		metrics.SnapshotAge.WithLabelValues(inst.host).Set(age.Seconds())
+	}
+}
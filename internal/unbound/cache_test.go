@@ -0,0 +1,115 @@
+package unbound
+
+import (
+	"context"
+	"errors"
+	unboundlib "github.com/guillomep/go-unbound"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+	"testing"
+	"time"
+)
+
+func TestCachedLocalData(t *testing.T) {
+	records := []unboundlib.RR{
+		{Name: "a.test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+	}
+
+	tests := []struct {
+		name     string
+		interval time.Duration
+		dumped   time.Duration
+		dumps    int
+	}{
+		{name: "disabled", interval: 0, dumps: 2},
+		{name: "fresh", interval: time.Minute, dumps: 1},
+		{name: "expired", interval: time.Minute, dumped: 2 * time.Minute, dumps: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mockClient{records: records}
+			inst := &instance{host: "unbound-0", client: m, snapshotInterval: tt.interval}
+
+			got, err := inst.cachedLocalData(context.TODO(), "")
+			assert.Nil(t, err)
+			assert.Equal(t, records, got)
+			if cached, ok := inst.cache[""]; ok {
+				cached.dumped = cached.dumped.Add(-tt.dumped)
+			}
+
+			got, err = inst.cachedLocalData(context.TODO(), "")
+			assert.Nil(t, err)
+			assert.Equal(t, records, got)
+			assert.Equal(t, tt.dumps, m.dumps)
+		})
+	}
+}
+
+func TestCachedLocalDataError(t *testing.T) {
+	m := &mockClient{views: map[string][]unboundlib.RR{"office": {}}}
+	inst := &instance{host: "unbound-0", client: m, snapshotInterval: time.Minute}
+
+	_, err := inst.cachedLocalData(context.TODO(), "office")
+	assert.Nil(t, err)
+
+	delete(m.views, "office")
+	inst.invalidateCache()
+	_, err = inst.cachedLocalData(context.TODO(), "office")
+	assert.ErrorContains(t, err, "view_list_local_data: no view with name: office")
+	assert.NotContains(t, inst.cache, "office")
+}
+
+func TestRecordsCache(t *testing.T) {
+	m := &mockClient{
+		records: []unboundlib.RR{
+			{Name: "a.test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+			{Name: "b.test.lan.", TTL: 300, Type: "A", Value: "192.168.1.2"},
+		},
+	}
+	p := &UnboundProvider{instances: []*instance{{host: "unbound-0", client: m, snapshotInterval: time.Minute}}}
+
+	_, err := p.Records(context.TODO())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, m.dumps)
+
+	// The changes are applied on a fresh snapshot and update the cache
+	err = p.ApplyChanges(context.TODO(), &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("c.test.lan", "A", endpoint.TTL(300), "192.168.1.3"),
+		},
+		Delete: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("a.test.lan", "A", endpoint.TTL(300), "192.168.1.1"),
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, m.dumps)
+
+	endpoints, err := p.Records(context.TODO())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, m.dumps)
+	assert.ElementsMatch(t, []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("b.test.lan", "A", endpoint.TTL(300), "192.168.1.2"),
+		endpoint.NewEndpointWithTTL("c.test.lan", "A", endpoint.TTL(300), "192.168.1.3"),
+	}, endpoints)
+
+	// A failed batch invalidates the cache
+	m.failOn = func(action string, rr unboundlib.RR) error {
+		if action == actionCreate && rr.Name == "d.test.lan" {
+			return errors.New("add failed")
+		}
+		return nil
+	}
+	err = p.ApplyChanges(context.TODO(), &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("d.test.lan", "A", endpoint.TTL(300), "192.168.1.4"),
+		},
+	})
+	assert.NotNil(t, err)
+	assert.Nil(t, p.instances[0].cache)
+
+	_, err = p.Records(context.TODO())
+	assert.Nil(t, err)
+	assert.Equal(t, 4, m.dumps)
+}
@@ -0,0 +1,183 @@
+package unbound
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"github.com/guillomep/external-dns-unbound-webhook/internal/metrics"
+	unboundlib "github.com/guillomep/go-unbound"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"time"
+)
+
+// certificateFiles are the TLS files of the control channel of an instance.
+type certificateFiles struct {
+	ca   string
+	key  string
+	cert string
+}
+
+// certificateFiles returns the TLS files of the i-th instance.
+func (c *Configuration) certificateFiles(i int) (certificateFiles, error) {
+	ca, err := instancePath(c.CaPemPath, i, len(c.Host))
+	if err != nil {
+		return certificateFiles{}, fmt.Errorf("invalid CA certificates: %w", err)
+	}
+	key, err := instancePath(c.KeyPemPath, i, len(c.Host))
+	if err != nil {
+		return certificateFiles{}, fmt.Errorf("invalid private keys: %w", err)
+	}
+	cert, err := instancePath(c.CertPemPath, i, len(c.Host))
+	if err != nil {
+		return certificateFiles{}, fmt.Errorf("invalid certificates: %w", err)
+	}
+	return certificateFiles{ca: ca, key: key, cert: cert}, nil
+}
+
+// empty returns true if the instance does not use TLS files.
+func (f certificateFiles) empty() bool {
+	return f.ca == "" && f.key == "" && f.cert == ""
+}
+
+// options returns the options of the library loading the files.
+func (f certificateFiles) options() []unboundlib.OptionFn {
+	return []unboundlib.OptionFn{
+		unboundlib.WithServerCertificatesFile(f.ca),
+		unboundlib.WithControlPrivateKeyFile(f.key),
+		unboundlib.WithControlCertificatesFile(f.cert),
+	}
+}
+
+// digest returns the digest of the contents of the files.
+func (f certificateFiles) digest() ([sha256.Size]byte, error) {
+	hash := sha256.New()
+	for _, path := range []string{f.ca, f.key, f.cert} {
+		if path == "" {
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return [sha256.Size]byte{}, err
+		}
+		fmt.Fprintf(hash, "%s:%d:", path, len(content))
+		hash.Write(content)
+	}
+	return [sha256.Size]byte(hash.Sum(nil)), nil
+}
+
+// certificateReloader replaces the TLS configuration of the client of an
+// instance when its files change.
+type certificateReloader struct {
+	host   string
+	files  certificateFiles
+	client *controlClient
+	// digest is the digest of the files the client uses.
+	digest [sha256.Size]byte
+}
+
+// newCertificateReloader returns the reloader of the files used by the client.
+func newCertificateReloader(host string, files certificateFiles, client *controlClient) (*certificateReloader, error) {
+	digest, err := files.digest()
+	if err != nil {
+		return nil, err
+	}
+	return &certificateReloader{host: host, files: files, client: client, digest: digest}, nil
+}
+
+// reload replaces the TLS configuration of the client if the files changed.
+// The new files are validated first, and must be accepted by Unbound: on
+// error, the client keeps its configuration and the files are reloaded again
+// on the next call. It returns true if the configuration was replaced.
+func (r *certificateReloader) reload(ctx context.Context) (bool, error) {
+	digest, err := r.files.digest()
+	if err != nil {
+		return false, err
+	}
+	if digest == r.digest {
+		return false, nil
+	}
+
+	options, err := loadOptions(r.files.options()...)
+	if err != nil {
+		return false, err
+	}
+	if err := validateCertificates(options); err != nil {
+		return false, err
+	}
+
+	tlsConfig := buildTLSConfig(options)
+	candidate := r.client.withTLSConfig(tlsConfig)
+	if err := probe(ctx, candidate); err != nil {
+		return false, fmt.Errorf("unbound rejected the new certificates: %w", err)
+	}
+
+	r.client.tlsConfig.Store(tlsConfig)
+	r.digest = digest
+	return true, nil
+}
+
+// validateCertificates checks that the control certificate matches the
+// control private key.
+func validateCertificates(options unboundlib.Options) error {
+	if len(options.ControlCertificates) == 0 || options.ControlPrivateKey == nil {
+		return nil
+	}
+	if !options.ControlPrivateKey.PublicKey.Equal(options.ControlCertificates[0].PublicKey) {
+		return fmt.Errorf("the control certificate does not match the control private key")
+	}
+	return nil
+}
+
+// probe checks that the client can send a command, until the context is done.
+func probe(ctx context.Context, client Client) error {
+	done := make(chan error, 1)
+	go func() { done <- client.Status() }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// StartCertificateReloader reloads the TLS files of the instances every
+// interval until the context is done.
+func (p *UnboundProvider) StartCertificateReloader(ctx context.Context, interval time.Duration) {
+	log.Infof("Watching the TLS files of the Unbound instances every %s", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.ReloadCertificates(ctx)
+		}
+	}
+}
+
+// ReloadCertificates replaces the TLS configuration of the instances whose
+// files changed. An instance whose new files cannot be used keeps its previous
+// configuration.
+func (p *UnboundProvider) ReloadCertificates(ctx context.Context) {
+	for _, inst := range p.instances {
+		if inst.certificates == nil {
+			continue
+		}
+
+		reloaded, err := inst.certificates.reload(ctx)
+		if err != nil {
+			log.WithField("instance", inst.host).Errorf("Could not reload the TLS certificates, keeping the previous ones: %v", err)
+			metrics.CertificateReloads.WithLabelValues(inst.host, metrics.Status(err)).Inc()
+			continue
+		}
+		if reloaded {
+			log.WithField("instance", inst.host).Info("Reloaded the TLS certificates of the control channel.")
+			metrics.CertificateReloads.WithLabelValues(inst.host, metrics.Status(nil)).Inc()
+		}
+	}
+}
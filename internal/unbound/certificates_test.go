@@ -0,0 +1,129 @@
+package unbound
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/guillomep/external-dns-unbound-webhook/internal/metrics"
+	"github.com/guillomep/external-dns-unbound-webhook/internal/testca"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+// newTLSFakeControl answers the commands of the clients authenticated by the
+// CA on a TLS control channel.
+func newTLSFakeControl(t *testing.T, ca *testca.CA) *fakeControl {
+	certPEM, keyPEM := ca.Issue(t, "unbound")
+	certificate, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.Cert)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	f := &fakeControl{listener: listener, answer: func(command string) string {
+		return "version: 1.19.0\n"
+	}}
+	go f.serve()
+	return f
+}
+
+func TestReloadCertificates(t *testing.T) {
+	ca := testca.NewRSA(t, "ca")
+	f := newTLSFakeControl(t, ca)
+
+	dir := t.TempDir()
+	files := certificateFiles{
+		ca:   filepath.Join(dir, "ca.pem"),
+		key:  filepath.Join(dir, "key.pem"),
+		cert: filepath.Join(dir, "cert.pem"),
+	}
+	certPEM, keyPEM := ca.Issue(t, "webhook")
+	testca.WriteFile(t, files.ca, ca.PEM())
+	testca.WriteFile(t, files.cert, certPEM)
+	testca.WriteFile(t, files.key, keyPEM)
+
+	p, err := NewProvider(&Configuration{
+		Host:        []string{f.host()},
+		DefaultTTL:  300,
+		CaPemPath:   []string{files.ca},
+		KeyPemPath:  []string{files.key},
+		CertPemPath: []string{files.cert},
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, p.Check())
+
+	inst := p.instances[0]
+	client := inst.certificates.client
+	reloads := func(status string) float64 {
+		return testutil.ToFloat64(metrics.CertificateReloads.WithLabelValues(inst.host, status))
+	}
+
+	// Unchanged files are not reloaded
+	reloaded, err := inst.certificates.reload(context.TODO())
+	assert.False(t, reloaded)
+	assert.Nil(t, err)
+
+	// A rotated certificate replaces the previous one
+	previous := client.tlsConfig.Load()
+	certPEM, keyPEM = ca.Issue(t, "webhook")
+	testca.WriteFile(t, files.cert, certPEM)
+	testca.WriteFile(t, files.key, keyPEM)
+	p.ReloadCertificates(context.TODO())
+	assert.NotSame(t, previous, client.tlsConfig.Load())
+	assert.Equal(t, 1.0, reloads("success"))
+	assert.Nil(t, p.Check())
+
+	// A certificate not matching the private key is rejected
+	previous = client.tlsConfig.Load()
+	certPEM, _ = ca.Issue(t, "webhook")
+	testca.WriteFile(t, files.cert, certPEM)
+	_, err = inst.certificates.reload(context.TODO())
+	assert.EqualError(t, err, "the control certificate does not match the control private key")
+	assert.Same(t, previous, client.tlsConfig.Load())
+
+	// A certificate not trusted by Unbound is rejected
+	certPEM, keyPEM = testca.NewRSA(t, "other").Issue(t, "webhook")
+	testca.WriteFile(t, files.cert, certPEM)
+	testca.WriteFile(t, files.key, keyPEM)
+	p.ReloadCertificates(context.TODO())
+	assert.Same(t, previous, client.tlsConfig.Load())
+	assert.Equal(t, 1.0, reloads("error"))
+	assert.Nil(t, p.Check())
+
+	// An invalid file is rejected
+	testca.WriteFile(t, files.cert, []byte("invalid"))
+	_, err = inst.certificates.reload(context.TODO())
+	assert.ErrorContains(t, err, "invalid certificate file")
+	assert.Same(t, previous, client.tlsConfig.Load())
+
+	// The files are reloaded once fixed
+	certPEM, keyPEM = ca.Issue(t, "webhook")
+	testca.WriteFile(t, files.cert, certPEM)
+	testca.WriteFile(t, files.key, keyPEM)
+	reloaded, err = inst.certificates.reload(context.TODO())
+	assert.True(t, reloaded)
+	assert.Nil(t, err)
+	assert.Nil(t, p.Check())
+}
+
+func TestReloadCertificatesWithoutFiles(t *testing.T) {
+	p, err := NewProvider(&Configuration{Host: []string{"tcp://127.0.0.1:8953"}, DefaultTTL: 300})
+	assert.Nil(t, err)
+	assert.Nil(t, p.instances[0].certificates)
+
+	// Nothing to reload
+	p.ReloadCertificates(context.TODO())
+}
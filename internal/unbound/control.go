@@ -0,0 +1,392 @@
+package unbound
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	unboundlib "github.com/guillomep/go-unbound"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// controlTimeout is the maximum duration of a command sent by the control
+// client.
+const controlTimeout = 10 * time.Second
+
+// rrPattern matches the records listed by Unbound.
+var rrPattern = regexp.MustCompile(`^(\S+)\t(\d+)\tIN\t([A-Z0-9]+)\t(.*)$`)
+
+// Client is the Unbound client used by the provider. Unlike the client of the
+// library, every command reports the errors of the control channel.
+type Client interface {
+	// ListLocalData returns the records of the global local data.
+	ListLocalData() ([]unboundlib.RR, error)
+	// AddLocalData adds a record to the global local data.
+	AddLocalData(rr unboundlib.RR) error
+	// RemoveLocalData removes all the records of a name from the global local
+	// data.
+	RemoveLocalData(rr unboundlib.RR) error
+	// Status checks that Unbound answers on its control channel.
+	Status() error
+	// LocalZones returns the local zones of Unbound.
+	LocalZones() ([]LocalZone, error)
+	// AddLocalZone declares a local zone, or changes its type.
+	AddLocalZone(name, zoneType string) error
+	// RemoveLocalZone removes a local zone and all its records.
+	RemoveLocalZone(name string) error
+	// ViewLocalData returns the records of a view.
+	ViewLocalData(view string) ([]unboundlib.RR, error)
+	// AddViewLocalData adds a record to a view.
+	AddViewLocalData(view string, rr unboundlib.RR) error
+	// RemoveViewLocalData removes all the records of a name from a view.
+	RemoveViewLocalData(view string, rr unboundlib.RR) error
+	// Flush removes the common types of a name from the cache.
+	Flush(name string) error
+	// FlushType removes a type of a name from the cache.
+	FlushType(name, recordType string) error
+	// FlushZone removes all the names of a zone from the cache.
+	FlushZone(name string) error
+	// AddLocalDatas adds records with a single command.
+	AddLocalDatas(records []unboundlib.RR) error
+	// RemoveLocalDatas removes all the records of names with a single
+	// command.
+	RemoveLocalDatas(names []string) error
+	// AddViewLocalDatas adds records to a view with a single command.
+	AddViewLocalDatas(view string, records []unboundlib.RR) error
+	// RemoveViewLocalDatas removes all the records of names from a view with
+	// a single command.
+	RemoveViewLocalDatas(view string, names []string) error
+}
+
+// deadlineClient is a client whose commands can be bounded by a deadline.
+type deadlineClient interface {
+	// withDeadline returns a client sending the commands with the deadline.
+	withDeadline(deadline time.Time) Client
+}
+
+// controlClient implements Client with the options of the library. Its TLS
+// configuration can be replaced while it is used.
+type controlClient struct {
+	network   string
+	address   string
+	tlsConfig *atomic.Pointer[tls.Config]
+	// deadline bounds the commands in addition to controlTimeout, if set.
+	deadline time.Time
+}
+
+// Compile time check for interface conformance
+var (
+	_ Client         = &controlClient{}
+	_ deadlineClient = &controlClient{}
+)
+
+func newControlClient(host string, opts ...unboundlib.OptionFn) (*controlClient, error) {
+	options, err := loadOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	parsedURL, err := url.Parse(host)
+	if err != nil {
+		return nil, err
+	}
+	address := parsedURL.Host
+	if parsedURL.Scheme == "unix" {
+		address = parsedURL.Path
+	}
+
+	client := &controlClient{
+		network:   parsedURL.Scheme,
+		address:   address,
+		tlsConfig: &atomic.Pointer[tls.Config]{},
+	}
+	client.tlsConfig.Store(buildTLSConfig(options))
+	return client, nil
+}
+
+// withTLSConfig returns a client of the same host with another TLS
+// configuration.
+func (c *controlClient) withTLSConfig(tlsConfig *tls.Config) *controlClient {
+	client := &controlClient{
+		network:   c.network,
+		address:   c.address,
+		tlsConfig: &atomic.Pointer[tls.Config]{},
+	}
+	client.tlsConfig.Store(tlsConfig)
+	return client
+}
+
+// withDeadline returns a client sharing the TLS configuration of the client,
+// whose commands are bounded by the deadline.
+func (c *controlClient) withDeadline(deadline time.Time) Client {
+	return &controlClient{
+		network:   c.network,
+		address:   c.address,
+		tlsConfig: c.tlsConfig,
+		deadline:  deadline,
+	}
+}
+
+// loadOptions applies the options of the library.
+func loadOptions(opts ...unboundlib.OptionFn) (unboundlib.Options, error) {
+	var options unboundlib.Options
+	for _, opt := range opts {
+		if err := opt(&options); err != nil {
+			return unboundlib.Options{}, err
+		}
+	}
+	return options, nil
+}
+
+// buildTLSConfig builds the TLS configuration the same way the library does.
+func buildTLSConfig(options unboundlib.Options) *tls.Config {
+	if len(options.ServerCertificates) == 0 && len(options.ControlCertificates) == 0 {
+		return nil
+	}
+
+	roots := x509.NewCertPool()
+	for _, cert := range options.ServerCertificates {
+		roots.AddCert(cert)
+	}
+
+	certificate := tls.Certificate{PrivateKey: options.ControlPrivateKey}
+	for _, cert := range options.ControlCertificates {
+		certificate.Certificate = append(certificate.Certificate, cert.Raw)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		RootCAs:      roots,
+		ServerName:   "unbound",
+	}
+}
+
+// command sends a command on the control channel and returns the lines of the
+// answer.
+func (c *controlClient) command(command string) ([]string, error) {
+	return c.exchange(command, nil)
+}
+
+// bulkCommand sends a command reading its input lines, like local_datas, on
+// the control channel and returns the lines of the answer. Unbound reports
+// the invalid input lines, so every line of the answer is checked for errors.
+func (c *controlClient) bulkCommand(command string, input []string) ([]string, error) {
+	lines, err := c.exchange(command, input)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range lines {
+		if failedAnswer(line) {
+			return nil, fmt.Errorf("%s: %s", strings.Fields(command)[0], line)
+		}
+	}
+	return lines, nil
+}
+
+// exchange sends a command followed by its input lines, if any, and returns
+// the lines of the answer. The command is bounded by the deadline of the
+// client and controlTimeout.
+func (c *controlClient) exchange(command string, input []string) ([]string, error) {
+	deadline := time.Now().Add(controlTimeout)
+	if !c.deadline.IsZero() && c.deadline.Before(deadline) {
+		deadline = c.deadline
+	}
+	dialer := &net.Dialer{Deadline: deadline}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	if tlsConfig := c.tlsConfig.Load(); tlsConfig == nil {
+		conn, err = dialer.Dial(c.network, c.address)
+	} else {
+		conn, err = tls.DialWithDialer(dialer, c.network, c.address, tlsConfig)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	writer := bufio.NewWriter(conn)
+	writer.WriteString("UBCT1 " + command + "\n")
+	if input != nil {
+		for _, line := range input {
+			writer.WriteString(line + "\n")
+		}
+		// End of transmission of the input
+		writer.WriteString("\x04\n")
+	}
+	if err := writer.Flush(); err != nil {
+		return nil, err
+	}
+
+	lines := []string{}
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		if scanner.Text() != "" {
+			lines = append(lines, scanner.Text())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(lines) > 0 && failedAnswer(lines[0]) {
+		return nil, fmt.Errorf("%s: %s", strings.Fields(command)[0], lines[0])
+	}
+	return lines, nil
+}
+
+// failedAnswer returns true if a line of an answer reports a failure. Unbound
+// answers the view commands with "no view with name" when the view does not
+// exist, without the usual error prefix.
+func failedAnswer(line string) bool {
+	return strings.HasPrefix(line, "error") || strings.HasPrefix(line, "no view with name")
+}
+
+func (c *controlClient) ListLocalData() ([]unboundlib.RR, error) {
+	lines, err := c.command("list_local_data")
+	if err != nil {
+		return nil, err
+	}
+	return parseRecords(lines), nil
+}
+
+func (c *controlClient) AddLocalData(rr unboundlib.RR) error {
+	_, err := c.command("local_data " + formatRR(rr))
+	return err
+}
+
+func (c *controlClient) RemoveLocalData(rr unboundlib.RR) error {
+	_, err := c.command("local_data_remove " + rr.Name)
+	return err
+}
+
+func (c *controlClient) Status() error {
+	lines, err := c.command("status")
+	if err != nil {
+		return err
+	}
+	if len(lines) == 0 {
+		return fmt.Errorf("status: empty answer")
+	}
+	return nil
+}
+
+func (c *controlClient) LocalZones() ([]LocalZone, error) {
+	lines, err := c.command("list_local_zones")
+	if err != nil {
+		return nil, err
+	}
+
+	zones := make([]LocalZone, 0, len(lines))
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("list_local_zones: invalid zone %q", line)
+		}
+		zones = append(zones, LocalZone{Name: fields[0], Type: fields[1]})
+	}
+	return zones, nil
+}
+
+func (c *controlClient) AddLocalZone(name, zoneType string) error {
+	_, err := c.command(fmt.Sprintf("local_zone %s %s", name, zoneType))
+	return err
+}
+
+func (c *controlClient) RemoveLocalZone(name string) error {
+	_, err := c.command("local_zone_remove " + name)
+	return err
+}
+
+func (c *controlClient) ViewLocalData(view string) ([]unboundlib.RR, error) {
+	lines, err := c.command("view_list_local_data " + view)
+	if err != nil {
+		return nil, err
+	}
+	return parseRecords(lines), nil
+}
+
+func (c *controlClient) AddViewLocalData(view string, rr unboundlib.RR) error {
+	_, err := c.command(fmt.Sprintf("view_local_data %s %s", view, formatRR(rr)))
+	return err
+}
+
+func (c *controlClient) RemoveViewLocalData(view string, rr unboundlib.RR) error {
+	_, err := c.command(fmt.Sprintf("view_local_data_remove %s %s", view, rr.Name))
+	return err
+}
+
+func (c *controlClient) Flush(name string) error {
+	_, err := c.command("flush " + name)
+	return err
+}
+
+func (c *controlClient) FlushType(name, recordType string) error {
+	_, err := c.command(fmt.Sprintf("flush_type %s %s", name, recordType))
+	return err
+}
+
+func (c *controlClient) FlushZone(name string) error {
+	_, err := c.command("flush_zone " + name)
+	return err
+}
+
+func (c *controlClient) AddLocalDatas(records []unboundlib.RR) error {
+	_, err := c.bulkCommand("local_datas", formatRRs(records))
+	return err
+}
+
+func (c *controlClient) RemoveLocalDatas(names []string) error {
+	_, err := c.bulkCommand("local_datas_remove", names)
+	return err
+}
+
+func (c *controlClient) AddViewLocalDatas(view string, records []unboundlib.RR) error {
+	_, err := c.bulkCommand("view_local_datas "+view, formatRRs(records))
+	return err
+}
+
+func (c *controlClient) RemoveViewLocalDatas(view string, names []string) error {
+	_, err := c.bulkCommand("view_local_datas_remove "+view, names)
+	return err
+}
+
+// parseRecords parses the records listed by Unbound, skipping the other
+// lines.
+func parseRecords(lines []string) []unboundlib.RR {
+	records := make([]unboundlib.RR, 0, len(lines))
+	for _, line := range lines {
+		matches := rrPattern.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+		ttl, _ := strconv.Atoi(matches[2])
+		records = append(records, unboundlib.RR{Name: matches[1], TTL: ttl, Type: matches[3], Value: matches[4]})
+	}
+	return records
+}
+
+// formatRR formats a record the way Unbound lists it.
+func formatRR(rr unboundlib.RR) string {
+	return fmt.Sprintf("%s\t%d\tIN\t%s\t%s", rr.Name, rr.TTL, rr.Type, rr.Value)
+}
+
+// formatRRs formats the records the way Unbound lists them.
+func formatRRs(records []unboundlib.RR) []string {
+	lines := make([]string, 0, len(records))
+	for _, rr := range records {
+		lines = append(lines, formatRR(rr))
+	}
+	return lines
+}
@@ -0,0 +1,266 @@
+package unbound
+
+import (
+	"bufio"
+	"fmt"
+	unboundlib "github.com/guillomep/go-unbound"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeControl is a fake Unbound control channel answering commands without
+// TLS.
+type fakeControl struct {
+	listener net.Listener
+	// answer returns the answer to a command.
+	answer func(command string) string
+
+	mu sync.Mutex
+	// inputs contains the input lines of the bulk commands.
+	inputs [][]string
+}
+
+func newFakeControl(t *testing.T, answer func(command string) string) *fakeControl {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	f := &fakeControl{listener: listener, answer: answer}
+	go f.serve()
+	return f
+}
+
+func (f *fakeControl) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		reader := bufio.NewReader(conn)
+		line, err := reader.ReadString('\n')
+		if err == nil {
+			command := strings.TrimPrefix(strings.TrimSuffix(line, "\n"), "UBCT1 ")
+			if strings.Contains(command, "local_datas") {
+				f.readInput(reader)
+			}
+			_, _ = conn.Write([]byte(f.answer(command)))
+		}
+		conn.Close()
+	}
+}
+
+// readInput reads the input lines of a bulk command, until the end of
+// transmission.
+func (f *fakeControl) readInput(reader *bufio.Reader) {
+	input := []string{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil || line == "\x04\n" {
+			break
+		}
+		input = append(input, strings.TrimSuffix(line, "\n"))
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.inputs = append(f.inputs, input)
+}
+
+func (f *fakeControl) host() string {
+	return fmt.Sprintf("tcp://%s", f.listener.Addr().String())
+}
+
+func TestControlClientStatus(t *testing.T) {
+	f := newFakeControl(t, func(command string) string {
+		if command == "status" {
+			return "version: 1.19.0\nverbosity: 1\nis running...\n"
+		}
+		return "error unknown command\n"
+	})
+
+	c, err := newControlClient(f.host())
+	assert.Nil(t, err)
+	assert.Nil(t, c.Status())
+
+	_, err = c.command("unknown")
+	assert.ErrorContains(t, err, "error unknown command")
+
+	c, err = newControlClient("tcp://127.0.0.1:1")
+	assert.Nil(t, err)
+	assert.NotNil(t, c.Status())
+}
+
+func TestControlClientStatusEmpty(t *testing.T) {
+	f := newFakeControl(t, func(command string) string {
+		return ""
+	})
+
+	c, err := newControlClient(f.host())
+	assert.Nil(t, err)
+	assert.ErrorContains(t, c.Status(), "empty answer")
+}
+
+func TestControlClientLocalZones(t *testing.T) {
+	commands := []string{}
+	f := newFakeControl(t, func(command string) string {
+		commands = append(commands, command)
+		switch command {
+		case "list_local_zones":
+			return "test.lan. static\nlocalhost. redirect\n"
+		case "local_zone test.lan static", "local_zone_remove test.lan":
+			return "ok\n"
+		}
+		return "error unknown command\n"
+	})
+
+	c, err := newControlClient(f.host())
+	assert.Nil(t, err)
+
+	zones, err := c.LocalZones()
+	assert.Nil(t, err)
+	assert.Equal(t, []LocalZone{
+		{Name: "test.lan.", Type: "static"},
+		{Name: "localhost.", Type: "redirect"},
+	}, zones)
+
+	assert.Nil(t, c.AddLocalZone("test.lan", "static"))
+	assert.Nil(t, c.RemoveLocalZone("test.lan"))
+	assert.Equal(t, []string{"list_local_zones", "local_zone test.lan static", "local_zone_remove test.lan"}, commands)
+}
+
+func TestControlClientViewLocalData(t *testing.T) {
+	commands := []string{}
+	f := newFakeControl(t, func(command string) string {
+		commands = append(commands, command)
+		switch {
+		case command == "view_list_local_data office":
+			return "a.test.lan.\t300\tIN\tA\t192.168.2.1\n_http._tcp.test.lan.\t300\tIN\tSRV\t0 5 80 a.test.lan.\n"
+		case strings.HasPrefix(command, "view_local_data office "), strings.HasPrefix(command, "view_local_data_remove office "):
+			return "ok\n"
+		}
+		// Unbound does not prefix this answer with error
+		return "no view with name: vpn\n"
+	})
+
+	c, err := newControlClient(f.host())
+	assert.Nil(t, err)
+
+	records, err := c.ViewLocalData("office")
+	assert.Nil(t, err)
+	assert.Equal(t, []unboundlib.RR{
+		{Name: "a.test.lan.", TTL: 300, Type: "A", Value: "192.168.2.1"},
+		{Name: "_http._tcp.test.lan.", TTL: 300, Type: "SRV", Value: "0 5 80 a.test.lan."},
+	}, records)
+
+	_, err = c.ViewLocalData("vpn")
+	assert.EqualError(t, err, "view_list_local_data: no view with name: vpn")
+
+	rr := unboundlib.RR{Name: "a.test.lan.", TTL: 300, Type: "A", Value: "192.168.2.1"}
+	assert.Nil(t, c.AddViewLocalData("office", rr))
+	assert.Nil(t, c.RemoveViewLocalData("office", rr))
+	assert.EqualError(t, c.AddViewLocalData("vpn", rr), "view_local_data: no view with name: vpn")
+	assert.EqualError(t, c.RemoveViewLocalData("vpn", rr), "view_local_data_remove: no view with name: vpn")
+	assert.Equal(t, []string{
+		"view_list_local_data office",
+		"view_list_local_data vpn",
+		"view_local_data office a.test.lan.\t300\tIN\tA\t192.168.2.1",
+		"view_local_data_remove office a.test.lan.",
+		"view_local_data vpn a.test.lan.\t300\tIN\tA\t192.168.2.1",
+		"view_local_data_remove vpn a.test.lan.",
+	}, commands)
+}
+
+func TestControlClientListLocalData(t *testing.T) {
+	f := newFakeControl(t, func(command string) string {
+		return "a.test.lan.\t300\tIN\tA\t192.168.1.1\n"
+	})
+
+	c, err := newControlClient(f.host())
+	assert.Nil(t, err)
+
+	records, err := c.ListLocalData()
+	assert.Nil(t, err)
+	assert.Equal(t, []unboundlib.RR{{Name: "a.test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"}}, records)
+
+	// The errors of the control channel are reported
+	f.listener.Close()
+	_, err = c.ListLocalData()
+	assert.NotNil(t, err)
+	assert.True(t, retryable(err))
+}
+
+func TestControlClientLocalDatas(t *testing.T) {
+	f := newFakeControl(t, func(command string) string {
+		switch command {
+		case "local_datas":
+			return "added 2 datas\n"
+		case "local_datas_remove", "view_local_datas_remove office":
+			return "removed 2 datas\n"
+		case "view_local_datas office":
+			return "error for input line: a.test.lan. 300 IN A invalid\nadded 0 datas\n"
+		case "view_local_datas vpn":
+			return "no view with name: vpn\n"
+		}
+		return "error unknown command\n"
+	})
+
+	c, err := newControlClient(f.host())
+	assert.Nil(t, err)
+
+	records := []unboundlib.RR{
+		{Name: "a.test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+		{Name: "a.test.lan.", TTL: 300, Type: "TXT", Value: "\"owner\""},
+	}
+	assert.Nil(t, c.AddLocalDatas(records))
+	assert.Nil(t, c.RemoveLocalDatas([]string{"a.test.lan", "b.test.lan"}))
+	assert.Nil(t, c.RemoveViewLocalDatas("office", []string{"a.test.lan"}))
+	assert.ErrorContains(t, c.AddViewLocalDatas("office", records[:1]), "view_local_datas: error for input line")
+	assert.EqualError(t, c.AddViewLocalDatas("vpn", records[:1]), "view_local_datas: no view with name: vpn")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	assert.Equal(t, [][]string{
+		{"a.test.lan.\t300\tIN\tA\t192.168.1.1", "a.test.lan.\t300\tIN\tTXT\t\"owner\""},
+		{"a.test.lan", "b.test.lan"},
+		{"a.test.lan"},
+		{"a.test.lan.\t300\tIN\tA\t192.168.1.1"},
+		{"a.test.lan.\t300\tIN\tA\t192.168.1.1"},
+	}, f.inputs)
+}
+
+func TestControlClientLocalData(t *testing.T) {
+	commands := []string{}
+	f := newFakeControl(t, func(command string) string {
+		commands = append(commands, command)
+		if strings.HasSuffix(command, "invalid") {
+			return "error parsing local-data\n"
+		}
+		return "ok\n"
+	})
+
+	c, err := newControlClient(f.host())
+	assert.Nil(t, err)
+
+	assert.Nil(t, c.AddLocalData(unboundlib.RR{Name: "a.test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"}))
+	assert.Nil(t, c.RemoveLocalData(unboundlib.RR{Name: "a.test.lan."}))
+	err = c.AddLocalData(unboundlib.RR{Name: "a.test.lan.", TTL: 300, Type: "A", Value: "invalid"})
+	assert.ErrorContains(t, err, "local_data: error parsing local-data")
+	assert.False(t, retryable(err))
+	assert.Equal(t, []string{
+		"local_data a.test.lan.\t300\tIN\tA\t192.168.1.1",
+		"local_data_remove a.test.lan.",
+		"local_data a.test.lan.\t300\tIN\tA\tinvalid",
+	}, commands)
+
+	// The errors of the control channel are wrapped
+	f.listener.Close()
+	err = c.AddLocalData(unboundlib.RR{Name: "a.test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"})
+	assert.NotNil(t, err)
+	assert.True(t, retryable(err))
+}
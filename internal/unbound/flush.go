@@ -0,0 +1,141 @@
+package unbound
+
+import (
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"slices"
+)
+
+const (
+	// CacheFlushNone never flushes the cache of Unbound.
+	CacheFlushNone = "none"
+	// CacheFlushName flushes the cache of every name touched by the changes.
+	CacheFlushName = "name"
+	// CacheFlushZone flushes the cache of the domains of the names touched by
+	// the changes, or of the names outside of the domain filter.
+	CacheFlushZone = "zone"
+)
+
+// flushedTypes are the types flushed by the flush command, the other types
+// need a flush_type command.
+var flushedTypes = []string{"A", "AAAA", "NS", "SOA", "CNAME", "DNAME", "MX", "PTR", "SRV", "NAPTR"}
+
+// flushCommand is a command flushing the cache of Unbound.
+type flushCommand struct {
+	command    string
+	name       string
+	recordType string
+}
+
+func (c flushCommand) String() string {
+	if c.recordType != "" {
+		return fmt.Sprintf("%s %s %s", c.command, c.name, c.recordType)
+	}
+	return fmt.Sprintf("%s %s", c.command, c.name)
+}
+
+// run sends the command to the client.
+func (c flushCommand) run(client Client) error {
+	switch c.command {
+	case "flush_type":
+		return client.FlushType(c.name, c.recordType)
+	case "flush_zone":
+		return client.FlushZone(c.name)
+	default:
+		return client.Flush(c.name)
+	}
+}
+
+// validateCacheFlush checks the cache flush mode of the configuration.
+func validateCacheFlush(config *Configuration) error {
+	switch config.CacheFlush {
+	case "", CacheFlushNone, CacheFlushName, CacheFlushZone:
+	default:
+		return invalidSetting("UNBOUND_CACHE_FLUSH", "unknown cache flush mode %q", config.CacheFlush)
+	}
+
+	if config.CacheFlush == CacheFlushName || config.CacheFlush == CacheFlushZone {
+		if config.CacheFlushMaxCommands <= 0 {
+			return invalidSetting("UNBOUND_CACHE_FLUSH_MAX_COMMANDS", "cache flush max commands must be positive, got %d", config.CacheFlushMaxCommands)
+		}
+	}
+	return nil
+}
+
+// flushDomain returns the domain flushed for a name: the longest domain of the
+// domain filter it belongs to, or the name itself. The cache is never flushed
+// above the managed domains.
+func (p *UnboundProvider) flushDomain(name string) string {
+	if domain := p.filterDomain(name); domain != "" {
+		return domain
+	}
+	return canonicalName(name)
+}
+
+// flushCommands returns the commands flushing the cache of the names touched
+// by the changes. To bound the number of commands of large batches, names
+// fall back to their domains when there would be more than the maximum number
+// of commands. No command is returned if the domains exceed it as well.
+func (p *UnboundProvider) flushCommands(changes []*UnboundChange) []flushCommand {
+	if p.cacheFlush == CacheFlushName {
+		commands := []flushCommand{}
+		for _, change := range changes {
+			command := flushCommand{command: "flush", name: canonicalName(change.RR.Name) + "."}
+			if !slices.Contains(flushedTypes, change.RR.Type) {
+				command.command = "flush_type"
+				command.recordType = change.RR.Type
+			}
+			if !slices.Contains(commands, command) {
+				commands = append(commands, command)
+			}
+		}
+		if len(commands) <= p.cacheFlushMaxCommands {
+			return commands
+		}
+	}
+
+	commands := []flushCommand{}
+	for _, change := range changes {
+		command := flushCommand{command: "flush_zone", name: p.flushDomain(change.RR.Name) + "."}
+		if !slices.Contains(commands, command) {
+			commands = append(commands, command)
+		}
+	}
+	if len(commands) <= p.cacheFlushMaxCommands {
+		return commands
+	}
+
+	log.Warnf("Not flushing the cache: %d domains changed, more than the %d flush commands allowed", len(commands), p.cacheFlushMaxCommands)
+	return nil
+}
+
+// flushCache flushes the cache of the names touched by the changes on the
+// instances the changes were applied to. The records are already changed, so
+// a failed flush is only logged.
+func (p *UnboundProvider) flushCache(ctx context.Context, changes []*UnboundChange) {
+	if p.cacheFlush == "" || p.cacheFlush == CacheFlushNone {
+		return
+	}
+
+	commands := p.flushCommands(changes)
+	if len(commands) == 0 {
+		return
+	}
+	for _, inst := range p.instances {
+		if len(inst.pending) > 0 {
+			continue
+		}
+
+		client := inst.control(ctx)
+		for _, command := range commands {
+			if err := command.run(client); err != nil {
+				log.WithFields(log.Fields{
+					"instance": inst.host,
+					"command":  command.String(),
+				}).Warnf("Could not flush the cache: %v", err)
+			}
+		}
+		log.WithField("instance", inst.host).Debugf("Flushed the cache with %d commands", len(commands))
+	}
+}
@@ -0,0 +1,110 @@
+package unbound
+
+import (
+	"context"
+	"errors"
+	unboundlib "github.com/guillomep/go-unbound"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+	"testing"
+)
+
+func TestValidateCacheFlush(t *testing.T) {
+	assert.Nil(t, validateCacheFlush(&Configuration{}))
+	assert.Nil(t, validateCacheFlush(&Configuration{CacheFlush: CacheFlushName, CacheFlushMaxCommands: 10}))
+	assert.ErrorContains(t, validateCacheFlush(&Configuration{CacheFlush: "all"}), `unknown cache flush mode "all"`)
+	assert.ErrorContains(t, validateCacheFlush(&Configuration{CacheFlush: CacheFlushZone}), "cache flush max commands must be positive, got 0")
+}
+
+func TestFlushCommands(t *testing.T) {
+	changes := []*UnboundChange{
+		{Action: actionCreate, RR: &unboundlib.RR{Name: "a.test.lan", Type: "A", Value: "192.168.1.1"}},
+		{Action: actionCreate, RR: &unboundlib.RR{Name: "a.test.lan", Type: "A", Value: "192.168.1.2"}},
+		{Action: actionCreate, RR: &unboundlib.RR{Name: "a.test.lan", Type: "TXT", Value: "\"owner\""}},
+		{Action: actionRemove, RR: &unboundlib.RR{Name: "b.test.lan.", Type: "CNAME", Value: "a.test.lan"}},
+		{Action: actionRemove, RR: &unboundlib.RR{Name: "a.example.com.", Type: "A", Value: "192.168.1.3"}},
+	}
+
+	tests := []struct {
+		name        string
+		mode        string
+		maxCommands int
+		domains     []string
+		expected    []string
+	}{
+		{
+			name:        "names",
+			mode:        CacheFlushName,
+			maxCommands: 10,
+			expected:    []string{"flush a.test.lan.", "flush_type a.test.lan. TXT", "flush b.test.lan.", "flush a.example.com."},
+		},
+		{
+			name:        "names fall back to domains",
+			mode:        CacheFlushName,
+			maxCommands: 3,
+			expected:    []string{"flush_zone test.lan.", "flush_zone example.com."},
+		},
+		{
+			name:        "domains",
+			mode:        CacheFlushZone,
+			maxCommands: 10,
+			expected:    []string{"flush_zone test.lan.", "flush_zone example.com."},
+		},
+		{
+			name:        "names outside of the domain filter",
+			mode:        CacheFlushZone,
+			maxCommands: 10,
+			domains:     []string{},
+			expected:    []string{"flush_zone a.test.lan.", "flush_zone b.test.lan.", "flush_zone a.example.com."},
+		},
+		{
+			name:        "domains exceed the maximum",
+			mode:        CacheFlushZone,
+			maxCommands: 1,
+			expected:    []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			domains := []string{"test.lan", "example.com"}
+			if tt.domains != nil {
+				domains = tt.domains
+			}
+			p := &UnboundProvider{
+				cacheFlush:            tt.mode,
+				cacheFlushMaxCommands: tt.maxCommands,
+				domainFilter:          testDomainFilter(t, Configuration{DomainFilter: domains}),
+			}
+
+			commands := []string{}
+			for _, command := range p.flushCommands(changes) {
+				commands = append(commands, command.String())
+			}
+			assert.Equal(t, tt.expected, commands)
+		})
+	}
+}
+
+func TestApplyChangesFlushCache(t *testing.T) {
+	first := &mockClient{}
+	second := &mockClient{failOn: func(action string, rr unboundlib.RR) error {
+		return errors.New("add failed")
+	}}
+	p := &UnboundProvider{
+		instances:             testInstances(first, second),
+		failurePolicy:         FailurePolicyTolerate,
+		cacheFlush:            CacheFlushName,
+		cacheFlushMaxCommands: 10,
+	}
+
+	err := p.ApplyChanges(context.TODO(), &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("a.test.lan", "A", endpoint.TTL(300), "192.168.1.1"),
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"flush a.test.lan."}, first.flushed)
+	assert.Empty(t, second.flushed)
+}
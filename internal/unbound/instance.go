@@ -0,0 +1,260 @@
+package unbound
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/guillomep/external-dns-unbound-webhook/internal/metrics"
+	unboundlib "github.com/guillomep/go-unbound"
+	log "github.com/sirupsen/logrus"
+	"slices"
+	"strings"
+	"time"
+)
+
+// instance is an Unbound server controlled by the provider.
+type instance struct {
+	host   string
+	client Client
+	// pending contains the changes that could not be applied on the instance
+	// and that must be retried.
+	pending []*UnboundChange
+	// bulkSize is the maximum number of lines of the bulk commands, zero to
+	// send one command per record.
+	bulkSize int
+	// cache contains the records of the views read by Records, dumped again
+	// once older than snapshotInterval. It is disabled if snapshotInterval is
+	// zero.
+	cache            map[string]*cachedView
+	snapshotInterval time.Duration
+	// retry is the retry policy of the commands failing with transient
+	// errors.
+	retry retryPolicy
+	// certificates reloads the TLS files of the client, nil if the instance
+	// does not use TLS files.
+	certificates *certificateReloader
+}
+
+// transaction contains the records of the names modified by a batch of
+// changes, as they were before the changes.
+type transaction struct {
+	attempted []string
+	modified  []string
+	snapshot  map[string][]unboundlib.RR
+	desired   map[string][]unboundlib.RR
+}
+
+// TransactionError is returned when a batch of changes could not be applied.
+// It describes the names the batch attempted to modify, the ones that were
+// restored to their previous records and the ones that could not be.
+type TransactionError struct {
+	Attempted   []string
+	RolledBack  []string
+	NotRestored []string
+	Err         error
+	RestoreErrs []error
+}
+
+func (e *TransactionError) Error() string {
+	msg := fmt.Sprintf("failed to apply changes on %s: %v", strings.Join(e.Attempted, ", "), e.Err)
+	if len(e.RolledBack) > 0 {
+		msg += fmt.Sprintf("; rolled back %s", strings.Join(e.RolledBack, ", "))
+	}
+	if len(e.NotRestored) > 0 {
+		msg += fmt.Sprintf("; could not restore %s: %v", strings.Join(e.NotRestored, ", "), errors.Join(e.RestoreErrs...))
+	}
+	return msg
+}
+
+func (e *TransactionError) Unwrap() []error {
+	return append([]error{e.Err}, e.RestoreErrs...)
+}
+
+// submitChanges applies the changes to the instance, whose records are in the
+// snapshot. Since Unbound can only remove all the records of a name at once,
+// the desired RRsets of every name touched by the changes are computed first,
+// then each modified name is removed and all its surviving records are added
+// back, either one command per record or with bulk commands. The desired
+// RRsets are computed from current, the records the provider knows the names
+// hold, rather than from the snapshot: a drifted instance gets the same records
+// as the others.
+//
+// If a command fails, every name modified so far is restored from the snapshot
+// and a *TransactionError is returned.
+func (i *instance) submitChanges(ctx context.Context, changes []*UnboundChange, snapshot, current map[string][]unboundlib.RR) (*transaction, error) {
+	names, desired := desiredRecords(current, changes)
+
+	tx := &transaction{
+		attempted: names,
+		modified:  []string{},
+		snapshot:  snapshot,
+		desired:   desired,
+	}
+	modified := []string{}
+	for _, name := range names {
+		if !sameRecords(snapshot[name], desired[name]) {
+			modified = append(modified, name)
+		}
+	}
+
+	if i.bulkSize > 0 {
+		// A failed bulk command may have partially modified its names
+		tx.modified = modified
+		if err := i.setRecordsBulk(ctx, modified, snapshot, desired); err != nil {
+			return nil, i.rollback(ctx, tx, err)
+		}
+		i.updateCache(tx)
+		return tx, nil
+	}
+
+	for _, name := range modified {
+		// Abort between two names, the ones already modified are rolled back
+		if err := ctx.Err(); err != nil {
+			return nil, i.rollback(ctx, tx, err)
+		}
+
+		tx.modified = append(tx.modified, name)
+		if err := i.setRecords(ctx, name, len(snapshot[name]) > 0, desired[name]); err != nil {
+			return nil, i.rollback(ctx, tx, err)
+		}
+	}
+
+	i.updateCache(tx)
+	return tx, nil
+}
+
+// changeViews returns the views of the changes, in the order of the changes.
+func changeViews(changes []*UnboundChange) []string {
+	views := []string{}
+	for _, change := range changes {
+		if !slices.Contains(views, change.View) {
+			views = append(views, change.View)
+		}
+	}
+	return views
+}
+
+// setRecords replaces the records of a name, identified by its key in its
+// view. The name is removed first when remove is true.
+func (i *instance) setRecords(ctx context.Context, key string, remove bool, records []unboundlib.RR) error {
+	view, name := splitScopedName(key)
+	if remove {
+		if err := i.removeLocalData(ctx, view, unboundlib.RR{Name: name}); err != nil {
+			return err
+		}
+	}
+	for _, rr := range records {
+		if err := i.addLocalData(ctx, view, rr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollback restores the names modified by the transaction after err occurred,
+// including the name being modified. The names are restored even if the
+// context is done. The cache is invalidated since the names may not have been
+// restored.
+func (i *instance) rollback(ctx context.Context, tx *transaction, err error) *TransactionError {
+	ctx = context.WithoutCancel(ctx)
+	i.invalidateCache()
+	txErr := &TransactionError{
+		Attempted: tx.attempted,
+		Err:       err,
+	}
+
+	for _, name := range tx.modified {
+		if restoreErr := i.setRecords(ctx, name, true, tx.snapshot[name]); restoreErr != nil {
+			log.WithFields(log.Fields{
+				"instance": i.host,
+				"record":   name,
+			}).Errorf("Could not restore records: %v", restoreErr)
+			txErr.NotRestored = append(txErr.NotRestored, name)
+			txErr.RestoreErrs = append(txErr.RestoreErrs, restoreErr)
+			continue
+		}
+		txErr.RolledBack = append(txErr.RolledBack, name)
+	}
+
+	return txErr
+}
+
+// localData returns the union of the records of all the instances in a view,
+// the global local data for the empty view. The number of records missing on
+// each instance read is added to divergent. Depending on the failure policy,
+// it fails unless every instance was read, or at least one of them.
+func (p *UnboundProvider) localData(ctx context.Context, view string, divergent []int) ([]unboundlib.RR, error) {
+	merged := []unboundlib.RR{}
+	seen := map[unboundlib.RR]bool{}
+	perInstance := make([]map[unboundlib.RR]bool, len(p.instances))
+	errs := []error{}
+
+	for i, inst := range p.instances {
+		records, err := inst.cachedLocalData(ctx, view)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"instance": inst.host,
+				"view":     view,
+			}).Warnf("Could not read the records of the view: %v", err)
+			errs = append(errs, fmt.Errorf("unbound instance %s: %w", inst.host, err))
+			continue
+		}
+
+		perInstance[i] = map[unboundlib.RR]bool{}
+		for _, rr := range records {
+			key := recordKey(rr)
+			perInstance[i][key] = true
+			if !seen[key] {
+				seen[key] = true
+				merged = append(merged, rr)
+			}
+		}
+	}
+
+	if len(errs) > 0 && (p.failurePolicy != FailurePolicyTolerate || len(errs) == len(p.instances)) {
+		return nil, errors.Join(errs...)
+	}
+
+	if len(p.instances) > 1 {
+		for i, inst := range p.instances {
+			// The records of the instances that could not be read are unknown
+			if perInstance[i] == nil {
+				continue
+			}
+
+			missing := []string{}
+			for _, rr := range merged {
+				if !perInstance[i][recordKey(rr)] {
+					missing = append(missing, fmt.Sprintf("%s %s %s", rr.Name, rr.Type, rr.Value))
+				}
+			}
+			divergent[i] += len(missing)
+			if len(missing) > 0 {
+				fields := log.Fields{"instance": inst.host}
+				if view != "" {
+					fields["view"] = view
+				}
+				log.WithFields(fields).Warnf("Unbound instance diverges, %d records are missing: %s", len(missing), strings.Join(missing, ", "))
+			}
+		}
+	}
+
+	return merged, nil
+}
+
+// updateDivergentRecords updates the number of records missing on each
+// instance of the metrics.
+func (p *UnboundProvider) updateDivergentRecords(divergent []int) {
+	if len(p.instances) < 2 {
+		return
+	}
+	for i, inst := range p.instances {
+		metrics.DivergentRecords.WithLabelValues(inst.host).Set(float64(divergent[i]))
+	}
+}
+
+// recordKey returns the record with its canonical name, to be used as a key.
+func recordKey(rr unboundlib.RR) unboundlib.RR {
+	rr.Name = canonicalName(rr.Name)
+	return rr
+}
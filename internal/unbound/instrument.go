@@ -0,0 +1,174 @@
+package unbound
+
+import (
+	"github.com/guillomep/external-dns-unbound-webhook/internal/metrics"
+	unboundlib "github.com/guillomep/go-unbound"
+	"sigs.k8s.io/external-dns/endpoint"
+	"strings"
+	"time"
+)
+
+// instrumentedClient records the metrics of the commands sent to the control
+// channel of an instance.
+type instrumentedClient struct {
+	host   string
+	client Client
+}
+
+// Compile time check for interface conformance
+var (
+	_ Client         = &instrumentedClient{}
+	_ deadlineClient = &instrumentedClient{}
+)
+
+// withDeadline bounds the commands of the client, if it supports deadlines.
+func (c *instrumentedClient) withDeadline(deadline time.Time) Client {
+	client := c.client
+	if bounded, ok := client.(deadlineClient); ok {
+		client = bounded.withDeadline(deadline)
+	}
+	return &instrumentedClient{host: c.host, client: client}
+}
+
+func (c *instrumentedClient) ListLocalData() ([]unboundlib.RR, error) {
+	start := time.Now()
+	records, err := c.client.ListLocalData()
+	metrics.ObserveControl(c.host, "list_local_data", start, err)
+	return records, err
+}
+
+func (c *instrumentedClient) AddLocalData(rr unboundlib.RR) error {
+	start := time.Now()
+	err := c.client.AddLocalData(rr)
+	metrics.ObserveControl(c.host, "local_data", start, err)
+	return err
+}
+
+func (c *instrumentedClient) RemoveLocalData(rr unboundlib.RR) error {
+	start := time.Now()
+	err := c.client.RemoveLocalData(rr)
+	metrics.ObserveControl(c.host, "local_data_remove", start, err)
+	return err
+}
+
+func (c *instrumentedClient) LocalZones() ([]LocalZone, error) {
+	start := time.Now()
+	zones, err := c.client.LocalZones()
+	metrics.ObserveControl(c.host, "list_local_zones", start, err)
+	return zones, err
+}
+
+func (c *instrumentedClient) AddLocalZone(name, zoneType string) error {
+	start := time.Now()
+	err := c.client.AddLocalZone(name, zoneType)
+	metrics.ObserveControl(c.host, "local_zone", start, err)
+	return err
+}
+
+func (c *instrumentedClient) RemoveLocalZone(name string) error {
+	start := time.Now()
+	err := c.client.RemoveLocalZone(name)
+	metrics.ObserveControl(c.host, "local_zone_remove", start, err)
+	return err
+}
+
+func (c *instrumentedClient) ViewLocalData(view string) ([]unboundlib.RR, error) {
+	start := time.Now()
+	records, err := c.client.ViewLocalData(view)
+	metrics.ObserveControl(c.host, "view_list_local_data", start, err)
+	return records, err
+}
+
+func (c *instrumentedClient) AddViewLocalData(view string, rr unboundlib.RR) error {
+	start := time.Now()
+	err := c.client.AddViewLocalData(view, rr)
+	metrics.ObserveControl(c.host, "view_local_data", start, err)
+	return err
+}
+
+func (c *instrumentedClient) RemoveViewLocalData(view string, rr unboundlib.RR) error {
+	start := time.Now()
+	err := c.client.RemoveViewLocalData(view, rr)
+	metrics.ObserveControl(c.host, "view_local_data_remove", start, err)
+	return err
+}
+
+func (c *instrumentedClient) Flush(name string) error {
+	start := time.Now()
+	err := c.client.Flush(name)
+	metrics.ObserveControl(c.host, "flush", start, err)
+	return err
+}
+
+func (c *instrumentedClient) FlushType(name, recordType string) error {
+	start := time.Now()
+	err := c.client.FlushType(name, recordType)
+	metrics.ObserveControl(c.host, "flush_type", start, err)
+	return err
+}
+
+func (c *instrumentedClient) FlushZone(name string) error {
+	start := time.Now()
+	err := c.client.FlushZone(name)
+	metrics.ObserveControl(c.host, "flush_zone", start, err)
+	return err
+}
+
+func (c *instrumentedClient) AddLocalDatas(records []unboundlib.RR) error {
+	start := time.Now()
+	err := c.client.AddLocalDatas(records)
+	metrics.ObserveControl(c.host, "local_datas", start, err)
+	return err
+}
+
+func (c *instrumentedClient) RemoveLocalDatas(names []string) error {
+	start := time.Now()
+	err := c.client.RemoveLocalDatas(names)
+	metrics.ObserveControl(c.host, "local_datas_remove", start, err)
+	return err
+}
+
+func (c *instrumentedClient) AddViewLocalDatas(view string, records []unboundlib.RR) error {
+	start := time.Now()
+	err := c.client.AddViewLocalDatas(view, records)
+	metrics.ObserveControl(c.host, "view_local_datas", start, err)
+	return err
+}
+
+func (c *instrumentedClient) RemoveViewLocalDatas(view string, names []string) error {
+	start := time.Now()
+	err := c.client.RemoveViewLocalDatas(view, names)
+	metrics.ObserveControl(c.host, "view_local_datas_remove", start, err)
+	return err
+}
+
+func (c *instrumentedClient) Status() error {
+	start := time.Now()
+	err := c.client.Status()
+	metrics.ObserveControl(c.host, "status", start, err)
+	return err
+}
+
+// managedRecordDomain returns the domain a record is accounted to in the
+// metrics: the longest domain of the domain filter it belongs to, or its
+// parent domain.
+func (p *UnboundProvider) managedRecordDomain(name string) string {
+	if domain := p.filterDomain(name); domain != "" {
+		return domain
+	}
+
+	name = canonicalName(name)
+
+	if _, parent, found := strings.Cut(name, "."); found {
+		return parent
+	}
+	return name
+}
+
+// updateManagedRecords updates the number of managed records of the metrics.
+func (p *UnboundProvider) updateManagedRecords(endpoints []*endpoint.Endpoint) {
+	metrics.ManagedRecords.Reset()
+	for _, ep := range endpoints {
+		metrics.ManagedRecords.WithLabelValues(ep.RecordType, p.managedRecordDomain(ep.DNSName)).Add(float64(len(ep.Targets)))
+	}
+}
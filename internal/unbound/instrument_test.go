@@ -0,0 +1,67 @@
+package unbound
+
+import (
+	"context"
+	"errors"
+	"github.com/guillomep/external-dns-unbound-webhook/internal/metrics"
+	unboundlib "github.com/guillomep/go-unbound"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestInstrumentedClient(t *testing.T) {
+	errAdd := errors.New("add failed")
+	c := &instrumentedClient{
+		host: "instrumented",
+		client: &mockClient{failOn: func(action string, rr unboundlib.RR) error {
+			if action == actionCreate {
+				return errAdd
+			}
+			return nil
+		}},
+	}
+
+	// The metrics are global, only their changes are checked
+	addErrs := testutil.ToFloat64(metrics.ControlErrors.WithLabelValues("instrumented", "local_data"))
+	removeErrs := testutil.ToFloat64(metrics.ControlErrors.WithLabelValues("instrumented", "local_data_remove"))
+
+	assert.ErrorIs(t, c.AddLocalData(unboundlib.RR{Name: "test.lan"}), errAdd)
+	assert.Nil(t, c.RemoveLocalData(unboundlib.RR{Name: "test.lan"}))
+	records, err := c.ListLocalData()
+	assert.Nil(t, err)
+	assert.Empty(t, records)
+
+	assert.Equal(t, addErrs+1, testutil.ToFloat64(metrics.ControlErrors.WithLabelValues("instrumented", "local_data")))
+	assert.Equal(t, removeErrs, testutil.ToFloat64(metrics.ControlErrors.WithLabelValues("instrumented", "local_data_remove")))
+}
+
+func TestManagedRecords(t *testing.T) {
+	m := &mockClient{records: []unboundlib.RR{
+		{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+		{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.2"},
+		{Name: "a.sub.test.lan.", TTL: 300, Type: "A", Value: "192.168.1.3"},
+		{Name: "a.example.com.", TTL: 3600, Type: "CNAME", Value: "abc.def"},
+	}}
+	p := &UnboundProvider{
+		instances:    testInstances(m),
+		domainFilter: testDomainFilter(t, Configuration{DomainFilter: []string{"test.lan", "sub.test.lan"}}),
+	}
+
+	_, err := p.Records(context.TODO())
+	assert.Nil(t, err)
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.ManagedRecords.WithLabelValues("A", "test.lan")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.ManagedRecords.WithLabelValues("A", "sub.test.lan")))
+	assert.Equal(t, 2, testutil.CollectAndCount(metrics.ManagedRecords))
+}
+
+func TestManagedRecordDomain(t *testing.T) {
+	p := &UnboundProvider{}
+	assert.Equal(t, "example.com", p.managedRecordDomain("a.example.com."))
+	assert.Equal(t, "lan", p.managedRecordDomain("test.lan"))
+	assert.Equal(t, "lan", p.managedRecordDomain("lan"))
+
+	p.domainFilter = testDomainFilter(t, Configuration{DomainFilter: []string{".example.com"}})
+	assert.Equal(t, "example.com", p.managedRecordDomain("b.a.example.com."))
+}
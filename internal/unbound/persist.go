@@ -0,0 +1,92 @@
+package unbound
+
+import (
+	"fmt"
+	"github.com/guillomep/external-dns-unbound-webhook/internal/unboundconf"
+	unboundlib "github.com/guillomep/go-unbound"
+	log "github.com/sirupsen/logrus"
+	"strings"
+)
+
+// persistZoneType is the type of the local zones declared for the domain
+// filter in the include file, unless the provider manages the local zones.
+// Transparent zones behave like the zones Unbound creates on its own for local
+// data.
+const persistZoneType = "transparent"
+
+// persistedZones returns the local zones declared by the provider before it
+// restarted, read from the include file. The transparent zones of the domain
+// filter written when the provider does not manage the local zones are not
+// declared by the provider.
+func (p *UnboundProvider) persistedZones() (map[string]string, error) {
+	zones, err := unboundconf.ReadZones(p.persistPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the local zones of %s: %w", p.persistPath, err)
+	}
+
+	declared := map[string]string{}
+	for _, zone := range zones {
+		name := canonicalName(zone.Name)
+		if p.localZoneType == "" && zone.Type == persistZoneType && p.filterDomain(name) == name {
+			continue
+		}
+		declared[name] = zone.Type
+	}
+	return declared, nil
+}
+
+// persist renders the desired state into the include file, and the records of
+// each view into the file of the view, if enabled. A failed write is retried
+// on the next call to Records.
+func (p *UnboundProvider) persist() {
+	if p.persistPath == "" || p.desired == nil {
+		return
+	}
+
+	records := []unboundlib.RR{}
+	// The file of every known view is written, even empty, so that the
+	// Unbound configuration can include it
+	viewRecords := map[string][]unboundlib.RR{}
+	for _, view := range p.recordViews() {
+		viewRecords[view] = []unboundlib.RR{}
+	}
+	for key, rrs := range p.desired {
+		if view, _ := splitScopedName(key); view != "" {
+			viewRecords[view] = append(viewRecords[view], rrs...)
+			continue
+		}
+		records = append(records, rrs...)
+	}
+
+	zoneTypes := map[string]string{}
+	if p.localZoneType == "" && p.domainFilter != nil {
+		for _, name := range p.domainFilter.Filters {
+			zoneTypes[strings.TrimPrefix(name, ".")] = persistZoneType
+		}
+	}
+	for name, zoneType := range p.zones {
+		zoneTypes[name] = zoneType
+	}
+
+	zones := make([]unboundconf.Zone, 0, len(zoneTypes))
+	for name, zoneType := range zoneTypes {
+		zones = append(zones, unboundconf.Zone{Name: name, Type: zoneType})
+	}
+
+	if err := unboundconf.WriteFile(p.persistPath, zones, records); err != nil {
+		log.Errorf("Could not persist records to %s: %v", p.persistPath, err)
+		p.persistPending = true
+		return
+	}
+	for view, rrs := range viewRecords {
+		path := unboundconf.ViewPath(p.persistPath, view)
+		if err := unboundconf.WriteViewFile(path, rrs); err != nil {
+			log.Errorf("Could not persist the records of view %s to %s: %v", view, path, err)
+			p.persistPending = true
+			return
+		}
+	}
+
+	log.Debugf("Persisted %d records to %s", len(records), p.persistPath)
+	p.persistPending = false
+}
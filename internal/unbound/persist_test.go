@@ -0,0 +1,117 @@
+package unbound
+
+import (
+	"context"
+	unboundlib "github.com/guillomep/go-unbound"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+	"testing"
+)
+
+func TestPersist(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "external-dns.conf")
+
+	m := &mockClient{records: []unboundlib.RR{
+		{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+		{Name: "a.example.com.", TTL: 3600, Type: "CNAME", Value: "abc.def."},
+	}}
+	p := &UnboundProvider{
+		instances:    testInstances(m),
+		domainFilter: testDomainFilter(t, Configuration{DomainFilter: []string{"test.lan"}}),
+		persistPath:  path,
+	}
+
+	_, err := p.Records(context.TODO())
+	assert.Nil(t, err)
+
+	content, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, `# Generated by external-dns-unbound-webhook, do not edit.
+server:
+  local-zone: "test.lan." transparent
+  local-data: "test.lan. 300 IN A 192.168.1.1"
+`, string(content))
+
+	err = p.ApplyChanges(context.TODO(), &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("a.test.lan", "A", endpoint.TTL(300), "192.168.1.2"),
+		},
+		Delete: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("test.lan", "A", endpoint.TTL(300), "192.168.1.1"),
+		},
+	})
+	assert.Nil(t, err)
+
+	content, err = os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, `# Generated by external-dns-unbound-webhook, do not edit.
+server:
+  local-zone: "test.lan." transparent
+  local-data: "a.test.lan. 300 IN A 192.168.1.2"
+`, string(content))
+}
+
+func TestPersistRetry(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "unbound", "external-dns.conf")
+
+	m := &mockClient{records: []unboundlib.RR{
+		{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+	}}
+	p := &UnboundProvider{
+		instances:   testInstances(m),
+		persistPath: path,
+	}
+
+	_, err := p.Records(context.TODO())
+	assert.Nil(t, err)
+	assert.True(t, p.persistPending)
+
+	if err := os.Mkdir(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = p.Records(context.TODO())
+	assert.Nil(t, err)
+	assert.False(t, p.persistPending)
+	assert.FileExists(t, path)
+}
+
+func TestPersistViews(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "external-dns.conf")
+
+	m := &mockClient{views: map[string][]unboundlib.RR{"office": {}}}
+	p := &UnboundProvider{
+		instances:    testInstances(m),
+		domainFilter: testDomainFilter(t, Configuration{}),
+		persistPath:  path,
+	}
+
+	err := p.ApplyChanges(context.TODO(), &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("a.test.lan", "A", endpoint.TTL(300), "192.168.1.1"),
+			endpoint.NewEndpointWithTTL("a.test.lan", "A", endpoint.TTL(300), "192.168.2.1").
+				WithProviderSpecific(PropertyView, "office"),
+		},
+	})
+	assert.Nil(t, err)
+
+	// The records of the view are in their own file, included from the view
+	// clause of the Unbound configuration
+	content, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, `# Generated by external-dns-unbound-webhook, do not edit.
+server:
+  local-data: "a.test.lan. 300 IN A 192.168.1.1"
+`, string(content))
+
+	content, err = os.ReadFile(filepath.Join(filepath.Dir(path), "external-dns.office.conf"))
+	assert.Nil(t, err)
+	assert.Equal(t, `# Generated by external-dns-unbound-webhook, do not edit.
+  local-data: "a.test.lan. 300 IN A 192.168.2.1"
+`, string(content))
+}
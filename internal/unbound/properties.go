@@ -0,0 +1,132 @@
+package unbound
+
+import (
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Provider specific properties of the endpoints. ExternalDNS prefixes the
+// properties of the webhook providers with "webhook/".
+const (
+	propertyPrefix = "webhook/unbound-"
+	// PropertyLocalZoneType declares a local zone of this type for the name
+	// of the endpoint.
+	PropertyLocalZoneType = "webhook/unbound-local-zone-type"
+	// PropertyPTR enables or disables the PTR records of the endpoint.
+	PropertyPTR = "webhook/unbound-ptr"
+	// PropertyTTLPolicy decides which TTL the records of the endpoint get.
+	PropertyTTLPolicy = "webhook/unbound-ttl-policy"
+	// PropertyView lists the views the records of the endpoint go to.
+	PropertyView = "webhook/unbound-view"
+)
+
+const (
+	// TTLPolicyEndpoint uses the TTL of the endpoint, or the default TTL if
+	// it has none.
+	TTLPolicyEndpoint = "endpoint"
+	// TTLPolicyDefault always uses the default TTL.
+	TTLPolicyDefault = "default"
+)
+
+// adjustProperties validates and normalizes the Unbound properties of the
+// endpoint. Invalid properties are dropped with a warning, so that the
+// endpoint is managed with the defaults of the provider and ExternalDNS does
+// not keep planning them.
+func (p *UnboundProvider) adjustProperties(ep *endpoint.Endpoint) {
+	var properties endpoint.ProviderSpecific
+	for _, property := range ep.ProviderSpecific {
+		if !strings.HasPrefix(property.Name, propertyPrefix) {
+			properties = append(properties, property)
+			continue
+		}
+
+		value, ok := normalizeProperty(property.Name, property.Value)
+		if !ok {
+			log.WithFields(log.Fields{
+				"record":   ep.DNSName,
+				"type":     ep.RecordType,
+				"property": property.Name,
+			}).Warnf("Ignoring invalid property value %q.", property.Value)
+			continue
+		}
+		properties = append(properties, endpoint.ProviderSpecificProperty{Name: property.Name, Value: value})
+	}
+	ep.ProviderSpecific = properties
+
+	if policy, ok := ep.GetProviderSpecificProperty(PropertyTTLPolicy); ok && policy == TTLPolicyDefault {
+		ep.RecordTTL = endpoint.TTL(p.defaultTTL)
+	}
+	p.adjustViews(ep)
+}
+
+// normalizeProperty returns the normalized value of an Unbound property, or
+// false if the property or its value is invalid.
+func normalizeProperty(name, value string) (string, bool) {
+	if name == PropertyView {
+		views, err := parseViews(value)
+		return strings.Join(views, ","), err == nil
+	}
+
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch name {
+	case PropertyLocalZoneType:
+		return value, slices.Contains(localZoneTypes, value)
+	case PropertyPTR:
+		enabled, err := strconv.ParseBool(value)
+		return strconv.FormatBool(enabled), err == nil
+	case PropertyTTLPolicy:
+		return value, value == TTLPolicyEndpoint || value == TTLPolicyDefault
+	default:
+		return "", false
+	}
+}
+
+// unboundProperties returns the Unbound properties of the endpoint.
+func unboundProperties(ep *endpoint.Endpoint) endpoint.ProviderSpecific {
+	properties := endpoint.ProviderSpecific{}
+	for _, property := range ep.ProviderSpecific {
+		if strings.HasPrefix(property.Name, propertyPrefix) {
+			properties = append(properties, property)
+		}
+	}
+	return properties
+}
+
+// updateProperties keeps the Unbound properties of the applied endpoints, so
+// that Records reports them back to ExternalDNS.
+func (p *UnboundProvider) updateProperties(changes *plan.Changes) {
+	if p.properties == nil {
+		p.properties = map[rrsetKey]endpoint.ProviderSpecific{}
+	}
+
+	for _, ep := range slices.Concat(changes.UpdateOld, changes.Delete) {
+		delete(p.properties, propertiesKey(ep))
+	}
+	for _, ep := range slices.Concat(changes.Create, changes.UpdateNew) {
+		if properties := unboundProperties(ep); len(properties) > 0 {
+			p.properties[propertiesKey(ep)] = properties
+		}
+	}
+}
+
+// endpointProperties returns the Unbound properties of an endpoint read from
+// Unbound: the properties it was applied with, and its views.
+func (p *UnboundProvider) endpointProperties(ep *endpoint.Endpoint) endpoint.ProviderSpecific {
+	properties := slices.Clone(p.properties[propertiesKey(ep)])
+	if ep.SetIdentifier != "" {
+		properties = slices.DeleteFunc(properties, func(property endpoint.ProviderSpecificProperty) bool {
+			return property.Name == PropertyView
+		})
+		properties = append(properties, endpoint.ProviderSpecificProperty{Name: PropertyView, Value: ep.SetIdentifier})
+	}
+	return properties
+}
+
+// propertiesKey returns the key of the properties of an endpoint.
+func propertiesKey(ep *endpoint.Endpoint) rrsetKey {
+	return rrsetKey{name: canonicalName(ep.DNSName), recordType: ep.RecordType, setIdentifier: ep.SetIdentifier}
+}
@@ -0,0 +1,88 @@
+package unbound
+
+import (
+	"context"
+	unboundlib "github.com/guillomep/go-unbound"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+	"testing"
+)
+
+func TestAdjustEndpointsProperties(t *testing.T) {
+	p := &UnboundProvider{defaultTTL: 300}
+
+	endpoints, err := p.AdjustEndpoints([]*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("a.test.lan", "A", endpoint.TTL(3600), "192.168.1.1").
+			WithProviderSpecific(PropertyPTR, "TRUE").
+			WithProviderSpecific(PropertyLocalZoneType, "Static").
+			WithProviderSpecific("webhook/other", "value"),
+		endpoint.NewEndpointWithTTL("b.test.lan", "A", endpoint.TTL(3600), "192.168.1.2").
+			WithProviderSpecific(PropertyPTR, "maybe").
+			WithProviderSpecific(PropertyLocalZoneType, "unknown").
+			WithProviderSpecific("webhook/unbound-unknown", "value"),
+		endpoint.NewEndpointWithTTL("c.test.lan", "A", endpoint.TTL(3600), "192.168.1.3").
+			WithProviderSpecific(PropertyTTLPolicy, TTLPolicyDefault),
+		endpoint.NewEndpointWithTTL("d.test.lan", "A", endpoint.TTL(3600), "192.168.1.4").
+			WithProviderSpecific(PropertyTTLPolicy, TTLPolicyEndpoint),
+	})
+	assert.Nil(t, err)
+
+	expected := []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("a.test.lan", "A", endpoint.TTL(3600), "192.168.1.1").
+			WithProviderSpecific(PropertyPTR, "true").
+			WithProviderSpecific(PropertyLocalZoneType, "static").
+			WithProviderSpecific("webhook/other", "value"),
+		endpoint.NewEndpointWithTTL("b.test.lan", "A", endpoint.TTL(3600), "192.168.1.2"),
+		endpoint.NewEndpointWithTTL("c.test.lan", "A", endpoint.TTL(300), "192.168.1.3").
+			WithProviderSpecific(PropertyTTLPolicy, TTLPolicyDefault),
+		endpoint.NewEndpointWithTTL("d.test.lan", "A", endpoint.TTL(3600), "192.168.1.4").
+			WithProviderSpecific(PropertyTTLPolicy, TTLPolicyEndpoint),
+	}
+	for _, ep := range expected {
+		ep.DNSName += "."
+	}
+	assert.Equal(t, expected, endpoints)
+}
+
+func TestApplyChangesProperties(t *testing.T) {
+	m := &mockClient{}
+	p := &UnboundProvider{
+		instances:    testInstances(m),
+		domainFilter: testDomainFilter(t, Configuration{}),
+	}
+
+	created := endpoint.NewEndpointWithTTL("a.test.lan", "A", endpoint.TTL(300), "192.168.1.1").
+		WithProviderSpecific(PropertyPTR, "true").
+		WithProviderSpecific(PropertyLocalZoneType, "static")
+	err := p.ApplyChanges(context.TODO(), &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			created,
+			endpoint.NewEndpointWithTTL("b.test.lan", "A", endpoint.TTL(300), "192.168.1.2"),
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []unboundlib.RR{
+		{Name: "a.test.lan", TTL: 300, Type: "A", Value: "192.168.1.1"},
+		{Name: "b.test.lan", TTL: 300, Type: "A", Value: "192.168.1.2"},
+		{Name: "1.1.168.192.in-addr.arpa.", TTL: 300, Type: "PTR", Value: "a.test.lan."},
+	}, m.records)
+	assert.Equal(t, map[string]string{"a.test.lan": "static"}, m.zones)
+
+	endpoints, err := p.Records(context.TODO())
+	assert.Nil(t, err)
+	assert.Equal(t, []*endpoint.Endpoint{
+		created,
+		endpoint.NewEndpointWithTTL("b.test.lan", "A", endpoint.TTL(300), "192.168.1.2"),
+	}, endpoints)
+
+	err = p.ApplyChanges(context.TODO(), &plan.Changes{
+		Delete: []*endpoint.Endpoint{created},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []unboundlib.RR{
+		{Name: "b.test.lan", TTL: 300, Type: "A", Value: "192.168.1.2"},
+	}, m.records)
+	assert.Empty(t, m.zones)
+	assert.Empty(t, p.properties)
+}
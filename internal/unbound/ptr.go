@@ -0,0 +1,85 @@
+package unbound
+
+import (
+	"fmt"
+	unboundlib "github.com/guillomep/go-unbound"
+	log "github.com/sirupsen/logrus"
+	"net/netip"
+	"sigs.k8s.io/external-dns/endpoint"
+	"strings"
+)
+
+// reverseName returns the name of the PTR record of an IP address, in the
+// in-addr.arpa space for IPv4 and in the ip6.arpa space for IPv6.
+func reverseName(ip string) (string, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "", err
+	}
+	addr = addr.Unmap()
+
+	var labels []string
+	if addr.Is4() {
+		for _, b := range addr.As4() {
+			labels = append([]string{fmt.Sprintf("%d", b)}, labels...)
+		}
+		return strings.Join(labels, ".") + ".in-addr.arpa.", nil
+	}
+
+	for _, b := range addr.As16() {
+		labels = append([]string{fmt.Sprintf("%x", b&0xf), fmt.Sprintf("%x", b>>4)}, labels...)
+	}
+	return strings.Join(labels, ".") + ".ip6.arpa.", nil
+}
+
+// inReverseZones returns true if the name belongs to one of the reverse zones
+// PTR records are restricted to, or if there is no restriction.
+func (p *UnboundProvider) inReverseZones(name string) bool {
+	if len(p.reverseZones) == 0 {
+		return true
+	}
+
+	name = canonicalName(name)
+	for _, zone := range p.reverseZones {
+		zone = canonicalName(zone)
+		if name == zone || strings.HasSuffix(name, "."+zone) {
+			return true
+		}
+	}
+	return false
+}
+
+// ptrChanges returns the changes of the PTR records matching the changes of
+// the A and AAAA records with PTR records enabled, in the same order.
+func (p *UnboundProvider) ptrChanges(changes []*UnboundChange) []*UnboundChange {
+	ptrChanges := []*UnboundChange{}
+	for _, change := range changes {
+		if !change.PTR || (change.RR.Type != endpoint.RecordTypeA && change.RR.Type != endpoint.RecordTypeAAAA) {
+			continue
+		}
+
+		name, err := reverseName(change.RR.Value)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"record": change.RR.Name,
+				"type":   change.RR.Type,
+			}).Warnf("Could not generate PTR record: %v", err)
+			continue
+		}
+		if !p.inReverseZones(name) {
+			continue
+		}
+
+		ptrChanges = append(ptrChanges, &UnboundChange{
+			Action: change.Action,
+			RR: &unboundlib.RR{
+				Name:  name,
+				TTL:   change.RR.TTL,
+				Type:  endpoint.RecordTypePTR,
+				Value: canonicalName(change.RR.Name) + ".",
+			},
+			View: change.View,
+		})
+	}
+	return ptrChanges
+}
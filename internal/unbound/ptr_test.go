@@ -0,0 +1,126 @@
+package unbound
+
+import (
+	"context"
+	unboundlib "github.com/guillomep/go-unbound"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+	"testing"
+)
+
+func TestReverseName(t *testing.T) {
+	tests := []struct {
+		ip       string
+		expected string
+		err      bool
+	}{
+		{ip: "192.168.1.10", expected: "10.1.168.192.in-addr.arpa."},
+		{ip: "::ffff:10.0.0.1", expected: "1.0.0.10.in-addr.arpa."},
+		{ip: "2001:db8::1", expected: "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa."},
+		{ip: "not-an-ip", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			name, err := reverseName(tt.ip)
+			if tt.err {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, name)
+		})
+	}
+}
+
+func TestApplyChangesPTR(t *testing.T) {
+	tests := []struct {
+		name         string
+		reverseZones []string
+		records      []unboundlib.RR
+		changes      *plan.Changes
+		expected     []unboundlib.RR
+	}{
+		{
+			name: "create",
+			changes: &plan.Changes{
+				Create: []*endpoint.Endpoint{
+					endpoint.NewEndpointWithTTL("test.lan", "A", endpoint.TTL(300), "192.168.1.1"),
+					endpoint.NewEndpointWithTTL("test.lan", "AAAA", endpoint.TTL(300), "2001:db8::1"),
+					endpoint.NewEndpointWithTTL("www.test.lan", "CNAME", endpoint.TTL(300), "test.lan"),
+				},
+			},
+			expected: []unboundlib.RR{
+				{Name: "test.lan", TTL: 300, Type: "A", Value: "192.168.1.1"},
+				{Name: "test.lan", TTL: 300, Type: "AAAA", Value: "2001:db8::1"},
+				{Name: "www.test.lan", TTL: 300, Type: "CNAME", Value: "test.lan"},
+				{Name: "1.1.168.192.in-addr.arpa.", TTL: 300, Type: "PTR", Value: "test.lan."},
+				{Name: "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", TTL: 300, Type: "PTR", Value: "test.lan."},
+			},
+		},
+		{
+			name: "delete keeps other names",
+			records: []unboundlib.RR{
+				{Name: "a.test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+				{Name: "b.test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+				{Name: "1.1.168.192.in-addr.arpa.", TTL: 300, Type: "PTR", Value: "a.test.lan."},
+				{Name: "1.1.168.192.in-addr.arpa.", TTL: 300, Type: "PTR", Value: "b.test.lan."},
+			},
+			changes: &plan.Changes{
+				Delete: []*endpoint.Endpoint{
+					endpoint.NewEndpointWithTTL("a.test.lan", "A", endpoint.TTL(300), "192.168.1.1"),
+				},
+			},
+			expected: []unboundlib.RR{
+				{Name: "b.test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+				{Name: "1.1.168.192.in-addr.arpa.", TTL: 300, Type: "PTR", Value: "b.test.lan."},
+			},
+		},
+		{
+			name:         "restricted to reverse zones",
+			reverseZones: []string{"168.192.in-addr.arpa"},
+			changes: &plan.Changes{
+				Create: []*endpoint.Endpoint{
+					endpoint.NewEndpointWithTTL("test.lan", "A", endpoint.TTL(300), "192.168.1.1", "10.0.0.1"),
+				},
+			},
+			expected: []unboundlib.RR{
+				{Name: "test.lan", TTL: 300, Type: "A", Value: "192.168.1.1"},
+				{Name: "test.lan", TTL: 300, Type: "A", Value: "10.0.0.1"},
+				{Name: "1.1.168.192.in-addr.arpa.", TTL: 300, Type: "PTR", Value: "test.lan."},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mockClient{records: tt.records}
+			p := &UnboundProvider{
+				instances:    testInstances(m),
+				ptrRecords:   true,
+				reverseZones: tt.reverseZones,
+			}
+
+			err := p.ApplyChanges(context.TODO(), tt.changes)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, m.records)
+		})
+	}
+}
+
+func TestRecordsHidesPTR(t *testing.T) {
+	m := &mockClient{records: []unboundlib.RR{
+		{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+		{Name: "1.1.168.192.in-addr.arpa.", TTL: 300, Type: "PTR", Value: "test.lan."},
+	}}
+	p := &UnboundProvider{
+		instances:  testInstances(m),
+		ptrRecords: true,
+	}
+
+	endpoints, err := p.Records(context.TODO())
+	assert.Nil(t, err)
+	assert.Equal(t, []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("test.lan.", "A", endpoint.TTL(300), "192.168.1.1"),
+	}, endpoints)
+}
@@ -0,0 +1,156 @@
+package unbound
+
+import (
+	"context"
+	"github.com/guillomep/external-dns-unbound-webhook/internal/metrics"
+	unboundlib "github.com/guillomep/go-unbound"
+	log "github.com/sirupsen/logrus"
+	"slices"
+	"time"
+)
+
+// initDesired initializes the desired state from the records of the managed
+// domains.
+func (p *UnboundProvider) initDesired(records []unboundlib.RR) {
+	p.desired = map[string][]unboundlib.RR{}
+	for _, rr := range records {
+		if p.domainFilter.Match(rr.Name) {
+			name := canonicalName(rr.Name)
+			p.desired[name] = append(p.desired[name], rr)
+		}
+	}
+}
+
+// updateDesired updates the desired state with the records of the successful
+// transactions, which computed them from the same current records.
+func (p *UnboundProvider) updateDesired(transactions []*transaction) {
+	for _, tx := range transactions {
+		if tx == nil {
+			continue
+		}
+
+		if p.desired == nil {
+			p.desired = map[string][]unboundlib.RR{}
+		}
+		for _, name := range tx.attempted {
+			p.desired[name] = tx.desired[name]
+		}
+	}
+}
+
+// currentRecords returns the records the names touched by the changes hold
+// before the changes: their desired records if the provider knows them, the
+// union of their records in the snapshots of the instances otherwise. The
+// drift of a single instance is thus not propagated to the others.
+func (p *UnboundProvider) currentRecords(changes []*UnboundChange, snapshots ...map[string][]unboundlib.RR) map[string][]unboundlib.RR {
+	current := map[string][]unboundlib.RR{}
+	for _, change := range changes {
+		key := scopedName(change.View, change.RR.Name)
+		if _, ok := current[key]; ok {
+			continue
+		}
+		if records, ok := p.desired[key]; ok {
+			current[key] = records
+			continue
+		}
+
+		records := []unboundlib.RR{}
+		for _, snapshot := range snapshots {
+			for _, rr := range snapshot[key] {
+				if !slices.ContainsFunc(records, func(r unboundlib.RR) bool { return sameRecord(r, rr) }) {
+					records = append(records, rr)
+				}
+			}
+		}
+		current[key] = records
+	}
+	return current
+}
+
+// StartReconciler reconciles the instances every interval until the context
+// is done.
+func (p *UnboundProvider) StartReconciler(ctx context.Context, interval time.Duration) {
+	log.Infof("Reconciling Unbound instances every %s", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.Reconcile(ctx)
+		}
+	}
+}
+
+// Reconcile compares the records of the managed names on every instance with
+// the desired state. Missing records are pushed again and stray records are
+// removed.
+func (p *UnboundProvider) Reconcile(ctx context.Context) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.dryRun || p.desired == nil {
+		return
+	}
+
+	for _, inst := range p.instances {
+		if len(p.zones) > 0 {
+			if err := p.repairZones(ctx, inst); err != nil {
+				log.WithField("instance", inst.host).Errorf("Could not repair local zones: %v", err)
+			}
+		}
+
+		current, err := inst.snapshot(ctx, p.recordViews())
+		if err != nil {
+			log.WithField("instance", inst.host).Errorf("Could not read records: %v", err)
+			continue
+		}
+
+		for name, records := range p.desired {
+			if sameRecords(current[name], records) {
+				continue
+			}
+			if ctx.Err() != nil {
+				return
+			}
+
+			inst.invalidateCache()
+			log.WithFields(log.Fields{
+				"instance": inst.host,
+				"record":   name,
+				"missing":  len(missingRecords(current[name], records)),
+				"stray":    len(missingRecords(records, current[name])),
+			}).Warn("Repairing drifted records.")
+
+			// A started repair is completed, the name would be left without
+			// records otherwise
+			err := inst.setRecords(context.WithoutCancel(ctx), name, len(current[name]) > 0, records)
+			metrics.Repairs.WithLabelValues(inst.host, metrics.Status(err)).Inc()
+			if err != nil {
+				log.WithFields(log.Fields{
+					"instance": inst.host,
+					"record":   name,
+				}).Errorf("Could not repair records: %v", err)
+			}
+		}
+	}
+}
+
+// missingRecords returns the wanted records that are not in the records.
+func missingRecords(records, wanted []unboundlib.RR) []unboundlib.RR {
+	present := map[unboundlib.RR]bool{}
+	for _, rr := range records {
+		present[recordKey(rr)] = true
+	}
+
+	missing := []unboundlib.RR{}
+	for _, rr := range wanted {
+		if !present[recordKey(rr)] {
+			missing = append(missing, rr)
+		}
+	}
+	return missing
+}
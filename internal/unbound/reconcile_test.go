@@ -0,0 +1,177 @@
+package unbound
+
+import (
+	"context"
+	unboundlib "github.com/guillomep/go-unbound"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+	"testing"
+	"time"
+)
+
+func TestReconcile(t *testing.T) {
+	first := &mockClient{records: []unboundlib.RR{
+		{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+		{Name: "test.lan.", TTL: 300, Type: "TXT", Value: "\"heritage=external-dns\""},
+	}}
+	second := &mockClient{records: []unboundlib.RR{
+		{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+		{Name: "test.lan.", TTL: 300, Type: "TXT", Value: "\"heritage=external-dns\""},
+	}}
+	p := &UnboundProvider{
+		instances:    testInstances(first, second),
+		domainFilter: testDomainFilter(t, Configuration{DomainFilter: []string{"test.lan"}}),
+	}
+
+	_, err := p.Records(context.TODO())
+	assert.Nil(t, err)
+
+	err = p.ApplyChanges(context.TODO(), &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("a.test.lan", "A", endpoint.TTL(300), "192.168.1.2"),
+		},
+	})
+	assert.Nil(t, err)
+
+	// The second instance restarted and lost everything, the first one has a
+	// stray record for a managed name
+	second.records = []unboundlib.RR{
+		{Name: "example.com.", TTL: 300, Type: "A", Value: "192.168.1.3"},
+	}
+	first.records = append(first.records, unboundlib.RR{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.4"})
+
+	p.Reconcile(context.TODO())
+
+	expected := []unboundlib.RR{
+		{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+		{Name: "test.lan.", TTL: 300, Type: "TXT", Value: "\"heritage=external-dns\""},
+		{Name: "a.test.lan", TTL: 300, Type: "A", Value: "192.168.1.2"},
+	}
+	assert.ElementsMatch(t, expected, first.records)
+	assert.ElementsMatch(t, append(expected, unboundlib.RR{Name: "example.com.", TTL: 300, Type: "A", Value: "192.168.1.3"}), second.records)
+}
+
+func TestReconcileDriftedInstance(t *testing.T) {
+	tests := []struct {
+		name string
+		// records is true if the records were read before the changes, the
+		// desired state is known then
+		records bool
+	}{
+		{name: "known desired state", records: true},
+		{name: "unknown desired state"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The first instance lost the ownership record of n.test.lan
+			first := &mockClient{records: []unboundlib.RR{
+				{Name: "n.test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+			}}
+			second := &mockClient{records: []unboundlib.RR{
+				{Name: "n.test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+				{Name: "n.test.lan.", TTL: 300, Type: "TXT", Value: "\"heritage=external-dns\""},
+			}}
+			p := &UnboundProvider{
+				instances:    testInstances(first, second),
+				domainFilter: testDomainFilter(t, Configuration{DomainFilter: []string{"test.lan"}}),
+			}
+
+			if tt.records {
+				_, err := p.Records(context.TODO())
+				assert.Nil(t, err)
+			}
+
+			err := p.ApplyChanges(context.TODO(), &plan.Changes{
+				UpdateOld: []*endpoint.Endpoint{
+					endpoint.NewEndpointWithTTL("n.test.lan", "A", endpoint.TTL(300), "192.168.1.1"),
+				},
+				UpdateNew: []*endpoint.Endpoint{
+					endpoint.NewEndpointWithTTL("n.test.lan", "A", endpoint.TTL(300), "192.168.1.2"),
+				},
+			})
+			assert.Nil(t, err)
+
+			// Both instances get the ownership record, which the
+			// reconciliation keeps
+			expected := []unboundlib.RR{
+				{Name: "n.test.lan.", TTL: 300, Type: "TXT", Value: "\"heritage=external-dns\""},
+				{Name: "n.test.lan", TTL: 300, Type: "A", Value: "192.168.1.2"},
+			}
+			assert.ElementsMatch(t, expected, p.desired["n.test.lan"])
+			p.Reconcile(context.TODO())
+			assert.ElementsMatch(t, expected, first.records)
+			assert.ElementsMatch(t, expected, second.records)
+		})
+	}
+}
+
+func TestReconcileWithoutDesiredState(t *testing.T) {
+	m := &mockClient{}
+	p := &UnboundProvider{
+		instances: testInstances(m),
+	}
+
+	p.Reconcile(context.TODO())
+	assert.Empty(t, m.records)
+}
+
+func TestReconcileDeletedRecords(t *testing.T) {
+	m := &mockClient{records: []unboundlib.RR{
+		{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+	}}
+	p := &UnboundProvider{
+		instances: testInstances(m),
+	}
+
+	_, err := p.Records(context.TODO())
+	assert.Nil(t, err)
+
+	err = p.ApplyChanges(context.TODO(), &plan.Changes{
+		Delete: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("test.lan", "A", endpoint.TTL(300), "192.168.1.1"),
+		},
+	})
+	assert.Nil(t, err)
+
+	// The record was pushed again by someone else
+	m.records = []unboundlib.RR{
+		{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+	}
+
+	p.Reconcile(context.TODO())
+	assert.Empty(t, m.records)
+}
+
+func TestStartReconciler(t *testing.T) {
+	m := &mockClient{records: []unboundlib.RR{
+		{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+	}}
+	p := &UnboundProvider{
+		instances: testInstances(m),
+	}
+
+	_, err := p.Records(context.TODO())
+	assert.Nil(t, err)
+
+	p.mu.Lock()
+	m.records = nil
+	p.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.StartReconciler(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return len(m.records) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+}
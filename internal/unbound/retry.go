@@ -0,0 +1,279 @@
+package unbound
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/guillomep/external-dns-unbound-webhook/internal/metrics"
+	unboundlib "github.com/guillomep/go-unbound"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"math/rand/v2"
+	"net"
+	"syscall"
+	"time"
+)
+
+// errAttemptTimeout is returned when an attempt of a command does not complete
+// within the attempt timeout.
+var errAttemptTimeout = errors.New("attempt timed out")
+
+// retryPolicy describes how the commands failing with transient errors are
+// retried.
+type retryPolicy struct {
+	// attempts is the maximum number of attempts of a command, a single
+	// attempt if not positive.
+	attempts int
+	// backoff is the delay before the first retry, doubled on every retry up
+	// to maxBackoff.
+	backoff    time.Duration
+	maxBackoff time.Duration
+	// attemptTimeout is the maximum duration of an attempt, unbounded if zero.
+	attemptTimeout time.Duration
+}
+
+// validateRetry checks the retry settings of the configuration.
+func validateRetry(config *Configuration) error {
+	var errs []error
+	if config.RetryAttempts < 0 {
+		errs = append(errs, invalidSetting("UNBOUND_RETRY_ATTEMPTS", "retry attempts must not be negative, got %d", config.RetryAttempts))
+	}
+	if config.RetryBackoff < 0 {
+		errs = append(errs, invalidSetting("UNBOUND_RETRY_BACKOFF", "retry backoff must not be negative, got %d", config.RetryBackoff))
+	}
+	if config.RetryMaxBackoff < 0 {
+		errs = append(errs, invalidSetting("UNBOUND_RETRY_MAX_BACKOFF", "retry max backoff must not be negative, got %d", config.RetryMaxBackoff))
+	}
+	if config.AttemptTimeout < 0 {
+		errs = append(errs, invalidSetting("UNBOUND_ATTEMPT_TIMEOUT", "attempt timeout must not be negative, got %d", config.AttemptTimeout))
+	}
+	return errors.Join(errs...)
+}
+
+// delay returns the delay before a retry, starting at 1. The exponential
+// backoff is jittered by up to half of it, so the instances are not retried
+// in lockstep.
+func (r retryPolicy) delay(retry int) time.Duration {
+	delay := r.backoff
+	for n := 1; n < retry && (r.maxBackoff == 0 || delay < r.maxBackoff); n++ {
+		delay *= 2
+	}
+	if r.maxBackoff > 0 {
+		delay = min(delay, r.maxBackoff)
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// retryable returns true if the error is transient, like a connection refused
+// or reset by Unbound, or a timeout. The errors answered by Unbound, the TLS
+// errors and the errors of the context are fatal.
+func retryable(err error) bool {
+	if errors.Is(err, errAttemptTimeout) {
+		return true
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var (
+		verificationErr *tls.CertificateVerificationError
+		recordErr       tls.RecordHeaderError
+		alertErr        tls.AlertError
+		authorityErr    x509.UnknownAuthorityError
+		hostnameErr     x509.HostnameError
+		invalidErr      x509.CertificateInvalidError
+	)
+	if errors.As(err, &verificationErr) || errors.As(err, &recordErr) || errors.As(err, &alertErr) ||
+		errors.As(err, &authorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &invalidErr) {
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+// retryClient retries the commands sent to an instance failing with transient
+// errors, until they succeed, the attempts are exhausted or the context is
+// done. It is bound to the context of a single provider call.
+type retryClient struct {
+	ctx    context.Context
+	host   string
+	client Client
+	policy retryPolicy
+}
+
+// Compile time check for interface conformance
+var _ Client = &retryClient{}
+
+// control returns the client of the instance, retrying the commands failing
+// with transient errors as long as the context is not done.
+func (i *instance) control(ctx context.Context) Client {
+	return &retryClient{ctx: ctx, host: i.host, client: i.client, policy: i.retry}
+}
+
+// retry sends a command with fn, retrying it according to the policy of the
+// client.
+func retry[T any](c *retryClient, command string, fn func(client Client) (T, error)) (T, error) {
+	var zero T
+	if err := c.ctx.Err(); err != nil {
+		return zero, err
+	}
+
+	attempts := max(c.policy.attempts, 1)
+	for attempt := 1; ; attempt++ {
+		result, err := attemptCommand(c, fn)
+		if err == nil || !retryable(err) {
+			return result, err
+		}
+		if attempt >= attempts {
+			if attempts > 1 {
+				err = fmt.Errorf("giving up after %d attempts: %w", attempts, err)
+			}
+			return zero, err
+		}
+
+		delay := c.policy.delay(attempt)
+		log.WithFields(log.Fields{
+			"instance": c.host,
+			"command":  command,
+			"attempt":  attempt,
+		}).Warnf("Retrying command in %s: %v", delay, err)
+		metrics.ControlRetries.WithLabelValues(c.host, command).Inc()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-c.ctx.Done():
+			timer.Stop()
+			return zero, errors.Join(err, c.ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// attemptCommand runs a single attempt of a command. The attempt timeout and
+// the deadline of the context are set on the connection of the command rather
+// than abandoning it: an attempt has completed or failed before the command
+// is retried, or the changes are rolled back.
+func attemptCommand[T any](c *retryClient, fn func(client Client) (T, error)) (T, error) {
+	var attemptDeadline time.Time
+	if c.policy.attemptTimeout > 0 {
+		attemptDeadline = time.Now().Add(c.policy.attemptTimeout)
+	}
+	ctxDeadline, hasCtxDeadline := c.ctx.Deadline()
+
+	client := c.client
+	if bounded, ok := client.(deadlineClient); ok {
+		switch {
+		case hasCtxDeadline && (attemptDeadline.IsZero() || ctxDeadline.Before(attemptDeadline)):
+			client = bounded.withDeadline(ctxDeadline)
+		case !attemptDeadline.IsZero():
+			client = bounded.withDeadline(attemptDeadline)
+		}
+	}
+
+	result, err := fn(client)
+	if err == nil {
+		return result, nil
+	}
+
+	var zero T
+	var netErr net.Error
+	timeout := errors.As(err, &netErr) && netErr.Timeout()
+	switch {
+	case c.ctx.Err() != nil:
+		return zero, errors.Join(err, c.ctx.Err())
+	case timeout && hasCtxDeadline && !time.Now().Before(ctxDeadline):
+		return zero, errors.Join(err, context.DeadlineExceeded)
+	case timeout && !attemptDeadline.IsZero() && !time.Now().Before(attemptDeadline):
+		return zero, errAttemptTimeout
+	}
+	return zero, err
+}
+
+// do sends a command without result with fn.
+func (c *retryClient) do(command string, fn func(client Client) error) error {
+	_, err := retry(c, command, func(client Client) (struct{}, error) {
+		return struct{}{}, fn(client)
+	})
+	return err
+}
+
+func (c *retryClient) ListLocalData() ([]unboundlib.RR, error) {
+	return retry(c, "list_local_data", Client.ListLocalData)
+}
+
+func (c *retryClient) AddLocalData(rr unboundlib.RR) error {
+	return c.do("local_data", func(client Client) error { return client.AddLocalData(rr) })
+}
+
+func (c *retryClient) RemoveLocalData(rr unboundlib.RR) error {
+	return c.do("local_data_remove", func(client Client) error { return client.RemoveLocalData(rr) })
+}
+
+func (c *retryClient) LocalZones() ([]LocalZone, error) {
+	return retry(c, "list_local_zones", Client.LocalZones)
+}
+
+func (c *retryClient) AddLocalZone(name, zoneType string) error {
+	return c.do("local_zone", func(client Client) error { return client.AddLocalZone(name, zoneType) })
+}
+
+func (c *retryClient) RemoveLocalZone(name string) error {
+	return c.do("local_zone_remove", func(client Client) error { return client.RemoveLocalZone(name) })
+}
+
+func (c *retryClient) ViewLocalData(view string) ([]unboundlib.RR, error) {
+	return retry(c, "view_list_local_data", func(client Client) ([]unboundlib.RR, error) {
+		return client.ViewLocalData(view)
+	})
+}
+
+func (c *retryClient) AddViewLocalData(view string, rr unboundlib.RR) error {
+	return c.do("view_local_data", func(client Client) error { return client.AddViewLocalData(view, rr) })
+}
+
+func (c *retryClient) RemoveViewLocalData(view string, rr unboundlib.RR) error {
+	return c.do("view_local_data_remove", func(client Client) error { return client.RemoveViewLocalData(view, rr) })
+}
+
+func (c *retryClient) Flush(name string) error {
+	return c.do("flush", func(client Client) error { return client.Flush(name) })
+}
+
+func (c *retryClient) FlushType(name, recordType string) error {
+	return c.do("flush_type", func(client Client) error { return client.FlushType(name, recordType) })
+}
+
+func (c *retryClient) FlushZone(name string) error {
+	return c.do("flush_zone", func(client Client) error { return client.FlushZone(name) })
+}
+
+func (c *retryClient) AddLocalDatas(records []unboundlib.RR) error {
+	return c.do("local_datas", func(client Client) error { return client.AddLocalDatas(records) })
+}
+
+func (c *retryClient) RemoveLocalDatas(names []string) error {
+	return c.do("local_datas_remove", func(client Client) error { return client.RemoveLocalDatas(names) })
+}
+
+func (c *retryClient) AddViewLocalDatas(view string, records []unboundlib.RR) error {
+	return c.do("view_local_datas", func(client Client) error { return client.AddViewLocalDatas(view, records) })
+}
+
+func (c *retryClient) RemoveViewLocalDatas(view string, names []string) error {
+	return c.do("view_local_datas_remove", func(client Client) error { return client.RemoveViewLocalDatas(view, names) })
+}
+
+func (c *retryClient) Status() error {
+	return c.do("status", Client.Status)
+}
@@ -0,0 +1,180 @@
+package unbound
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	unboundlib "github.com/guillomep/go-unbound"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestValidateRetry(t *testing.T) {
+	assert.Nil(t, validateRetry(&Configuration{RetryAttempts: 3, RetryBackoff: 100, RetryMaxBackoff: 5000, AttemptTimeout: 1000}))
+	assert.ErrorContains(t, validateRetry(&Configuration{RetryAttempts: -1}), "retry attempts must not be negative, got -1")
+	assert.ErrorContains(t, validateRetry(&Configuration{RetryBackoff: -1}), "retry backoff must not be negative, got -1")
+	assert.ErrorContains(t, validateRetry(&Configuration{RetryMaxBackoff: -1}), "retry max backoff must not be negative, got -1")
+	assert.ErrorContains(t, validateRetry(&Configuration{AttemptTimeout: -1}), "attempt timeout must not be negative, got -1")
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := retryPolicy{backoff: 100 * time.Millisecond, maxBackoff: time.Second}
+
+	tests := []struct {
+		retry int
+		min   time.Duration
+		max   time.Duration
+	}{
+		{retry: 1, min: 50 * time.Millisecond, max: 100 * time.Millisecond},
+		{retry: 2, min: 100 * time.Millisecond, max: 200 * time.Millisecond},
+		{retry: 3, min: 200 * time.Millisecond, max: 400 * time.Millisecond},
+		{retry: 10, min: 500 * time.Millisecond, max: time.Second},
+		{retry: 100, min: 500 * time.Millisecond, max: time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("retry %d", tt.retry), func(t *testing.T) {
+			for range 100 {
+				delay := policy.delay(tt.retry)
+				assert.GreaterOrEqual(t, delay, tt.min)
+				assert.LessOrEqual(t, delay, tt.max)
+			}
+		})
+	}
+
+	assert.Zero(t, retryPolicy{}.delay(1))
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		retryable bool
+	}{
+		{name: "connection refused", err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, retryable: true},
+		{name: "connection reset", err: fmt.Errorf("read: %w", syscall.ECONNRESET), retryable: true},
+		{name: "closed connection", err: io.EOF, retryable: true},
+		{name: "attempt timeout", err: errAttemptTimeout, retryable: true},
+		{name: "unbound error", err: errors.New("local_data: error parsing local-data"), retryable: false},
+		{name: "unknown authority", err: &tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}, retryable: false},
+		{name: "not tls", err: tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}, retryable: false},
+		{name: "canceled", err: context.Canceled, retryable: false},
+		{name: "deadline exceeded", err: context.DeadlineExceeded, retryable: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.retryable, retryable(tt.err))
+		})
+	}
+}
+
+// flakyClient fails the first additions of records.
+type flakyClient struct {
+	*mockClient
+	failures int
+	err      error
+	calls    int
+}
+
+func (c *flakyClient) AddLocalData(rr unboundlib.RR) error {
+	c.calls++
+	if c.calls <= c.failures {
+		return c.err
+	}
+	return c.mockClient.AddLocalData(rr)
+}
+
+func TestRetryClient(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		attempts int
+		failures int
+		err      error
+		calls    int
+		expected string
+	}{
+		{name: "success", ctx: context.Background(), attempts: 3, failures: 0, err: refused, calls: 1},
+		{name: "transient errors", ctx: context.Background(), attempts: 3, failures: 2, err: refused, calls: 3},
+		{name: "exhausted attempts", ctx: context.Background(), attempts: 3, failures: 3, err: refused, calls: 3, expected: "giving up after 3 attempts: dial tcp: connection refused"},
+		{name: "single attempt", ctx: context.Background(), attempts: 0, failures: 1, err: refused, calls: 1, expected: "dial tcp: connection refused"},
+		{name: "fatal error", ctx: context.Background(), attempts: 3, failures: 1, err: errors.New("local_data: error"), calls: 1, expected: "local_data: error"},
+		{name: "canceled", ctx: canceled, attempts: 3, failures: 0, calls: 0, expected: "context canceled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &flakyClient{mockClient: &mockClient{}, failures: tt.failures, err: tt.err}
+			inst := &instance{host: "unbound-0", client: client, retry: retryPolicy{attempts: tt.attempts, backoff: time.Millisecond}}
+
+			err := inst.control(tt.ctx).AddLocalData(unboundlib.RR{Name: "a.test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"})
+			if tt.expected == "" {
+				assert.Nil(t, err)
+				assert.Len(t, client.records, 1)
+			} else {
+				assert.EqualError(t, err, tt.expected)
+			}
+			assert.Equal(t, tt.calls, client.calls)
+		})
+	}
+}
+
+func TestRetryClientListLocalData(t *testing.T) {
+	m := &mockClient{dumpErr: io.EOF}
+	inst := &instance{host: "unbound-0", client: m, retry: retryPolicy{attempts: 2, backoff: time.Millisecond}}
+
+	_, err := inst.control(context.Background()).ListLocalData()
+	assert.EqualError(t, err, "giving up after 2 attempts: EOF")
+	assert.Equal(t, 2, m.dumps)
+}
+
+func TestRetryClientAttemptTimeout(t *testing.T) {
+	f := newFakeControl(t, func(command string) string {
+		time.Sleep(200 * time.Millisecond)
+		return "ok\n"
+	})
+	client, err := newControlClient(f.host())
+	assert.Nil(t, err)
+	rr := unboundlib.RR{Name: "a.test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"}
+
+	// The attempt timeout is the deadline of the connection
+	inst := &instance{host: "unbound-0", client: client, retry: retryPolicy{attempts: 2, attemptTimeout: 10 * time.Millisecond}}
+	start := time.Now()
+	err = inst.control(context.Background()).AddLocalData(rr)
+	assert.ErrorIs(t, err, errAttemptTimeout)
+	assert.EqualError(t, err, "giving up after 2 attempts: attempt timed out")
+	assert.Less(t, time.Since(start), 200*time.Millisecond)
+
+	// So is the deadline of the context, which is not retried
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	inst.retry.attemptTimeout = time.Second
+	start = time.Now()
+	err = inst.control(ctx).AddLocalData(rr)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 200*time.Millisecond)
+}
+
+func TestRetryClientCanceledBackoff(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	client := &flakyClient{mockClient: &mockClient{}, failures: 1, err: io.EOF}
+	inst := &instance{host: "unbound-0", client: client, retry: retryPolicy{attempts: 3, backoff: time.Minute}}
+
+	err := inst.control(ctx).AddLocalData(unboundlib.RR{Name: "a.test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"})
+	assert.ErrorIs(t, err, io.EOF)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 1, client.calls)
+}
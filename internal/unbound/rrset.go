@@ -0,0 +1,88 @@
+package unbound
+
+import (
+	unboundlib "github.com/guillomep/go-unbound"
+	"strings"
+)
+
+// canonicalName returns the name used to compare records names, Unbound
+// always returns fully qualified names while endpoints may not be.
+func canonicalName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// sameRecord returns true if both records hold the same data, regardless of
+// their TTL.
+func sameRecord(a, b unboundlib.RR) bool {
+	return canonicalName(a.Name) == canonicalName(b.Name) && a.Type == b.Type && a.Value == b.Value
+}
+
+// groupByName groups the records by canonical name.
+func groupByName(records []unboundlib.RR) map[string][]unboundlib.RR {
+	grouped := map[string][]unboundlib.RR{}
+	for _, rr := range records {
+		name := canonicalName(rr.Name)
+		grouped[name] = append(grouped[name], rr)
+	}
+	return grouped
+}
+
+// desiredRecords computes the records each name touched by the changes must
+// hold once the changes are applied. It returns the keys of the touched names
+// in the order of the changes, and the desired records of every touched name,
+// including the records of other types or targets that are left untouched.
+func desiredRecords(current map[string][]unboundlib.RR, changes []*UnboundChange) ([]string, map[string][]unboundlib.RR) {
+	names := []string{}
+	desired := map[string][]unboundlib.RR{}
+
+	for _, change := range changes {
+		name := scopedName(change.View, change.RR.Name)
+		records, ok := desired[name]
+		if !ok {
+			names = append(names, name)
+			records = append([]unboundlib.RR{}, current[name]...)
+		}
+
+		switch change.Action {
+		case actionCreate:
+			records = removeRecord(records, *change.RR)
+			records = append(records, *change.RR)
+		case actionRemove:
+			records = removeRecord(records, *change.RR)
+		}
+		desired[name] = records
+	}
+
+	return names, desired
+}
+
+// removeRecord removes the records holding the same data as rr.
+func removeRecord(records []unboundlib.RR, rr unboundlib.RR) []unboundlib.RR {
+	kept := records[:0]
+	for _, r := range records {
+		if !sameRecord(r, rr) {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// sameRecords returns true if both lists contain exactly the same records,
+// TTL included, in any order.
+func sameRecords(a, b []unboundlib.RR) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	count := map[unboundlib.RR]int{}
+	for _, rr := range a {
+		count[recordKey(rr)]++
+	}
+	for _, rr := range b {
+		if count[recordKey(rr)] == 0 {
+			return false
+		}
+		count[recordKey(rr)]--
+	}
+	return true
+}
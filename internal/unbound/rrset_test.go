@@ -0,0 +1,53 @@
+package unbound
+
+import (
+	unboundlib "github.com/guillomep/go-unbound"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDesiredRecords(t *testing.T) {
+	current := groupByName([]unboundlib.RR{
+		{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+		{Name: "test.lan.", TTL: 300, Type: "TXT", Value: "\"heritage=external-dns\""},
+		{Name: "a.test.lan.", TTL: 300, Type: "A", Value: "192.168.1.2"},
+	})
+
+	changes := []*UnboundChange{
+		{Action: actionRemove, RR: &unboundlib.RR{Name: "test.lan", TTL: 300, Type: "A", Value: "192.168.1.1"}},
+		{Action: actionCreate, RR: &unboundlib.RR{Name: "b.test.lan", TTL: 300, Type: "A", Value: "192.168.1.3"}},
+		{Action: actionCreate, RR: &unboundlib.RR{Name: "TEST.lan", TTL: 600, Type: "A", Value: "192.168.1.4"}},
+	}
+
+	names, desired := desiredRecords(current, changes)
+	assert.Equal(t, []string{"test.lan", "b.test.lan"}, names)
+	assert.Equal(t, map[string][]unboundlib.RR{
+		"test.lan": {
+			{Name: "test.lan.", TTL: 300, Type: "TXT", Value: "\"heritage=external-dns\""},
+			{Name: "TEST.lan", TTL: 600, Type: "A", Value: "192.168.1.4"},
+		},
+		"b.test.lan": {
+			{Name: "b.test.lan", TTL: 300, Type: "A", Value: "192.168.1.3"},
+		},
+	}, desired)
+	assert.Len(t, current["test.lan"], 2, "current records must not be modified")
+}
+
+func TestSameRecords(t *testing.T) {
+	a := []unboundlib.RR{
+		{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+		{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.2"},
+	}
+
+	assert.True(t, sameRecords(a, []unboundlib.RR{
+		{Name: "test.lan", TTL: 300, Type: "A", Value: "192.168.1.2"},
+		{Name: "test.lan", TTL: 300, Type: "A", Value: "192.168.1.1"},
+	}))
+	assert.False(t, sameRecords(a, []unboundlib.RR{
+		{Name: "test.lan", TTL: 300, Type: "A", Value: "192.168.1.1"},
+	}))
+	assert.False(t, sameRecords(a, []unboundlib.RR{
+		{Name: "test.lan", TTL: 600, Type: "A", Value: "192.168.1.1"},
+		{Name: "test.lan", TTL: 300, Type: "A", Value: "192.168.1.2"},
+	}))
+}
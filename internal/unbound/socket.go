@@ -0,0 +1,41 @@
+package unbound
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+)
+
+// socketPath returns the path of the control socket of a unix:// host.
+func socketPath(host string) (string, bool) {
+	parsedURL, err := url.Parse(host)
+	if err != nil || parsedURL.Scheme != "unix" {
+		return "", false
+	}
+	return parsedURL.Path, true
+}
+
+// validateSocket checks that the control socket exists and is writable,
+// otherwise every command would fail.
+func validateSocket(path string) error {
+	if path == "" {
+		return fmt.Errorf("missing path of the control socket, expected unix:///path/to/socket")
+	}
+
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("control socket %s does not exist, check the control-interface of Unbound", path)
+	}
+	if err != nil {
+		return fmt.Errorf("control socket %s: %w", path, err)
+	}
+	if info.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("control socket %s is not a socket", path)
+	}
+	if err := checkWritable(path); err != nil {
+		return fmt.Errorf("control socket %s is not writable by the webhook: %w", path, err)
+	}
+	return nil
+}
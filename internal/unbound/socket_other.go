@@ -0,0 +1,9 @@
+//go:build !unix
+
+package unbound
+
+// checkWritable does not check the permissions, they are only checked by the
+// first command.
+func checkWritable(path string) error {
+	return nil
+}
@@ -0,0 +1,67 @@
+package unbound
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newSocket listens on a control socket in a temporary directory.
+func newSocket(t *testing.T) (string, net.Listener) {
+	path := filepath.Join(t.TempDir(), "unbound.ctl")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	return path, listener
+}
+
+func TestSocketPath(t *testing.T) {
+	path, ok := socketPath("unix:///run/unbound.ctl")
+	assert.True(t, ok)
+	assert.Equal(t, "/run/unbound.ctl", path)
+
+	_, ok = socketPath("tcp://127.0.0.1:8953")
+	assert.False(t, ok)
+}
+
+func TestValidateSocket(t *testing.T) {
+	path, _ := newSocket(t)
+	assert.Nil(t, validateSocket(path))
+
+	missing := filepath.Join(t.TempDir(), "missing.ctl")
+	assert.EqualError(t, validateSocket(missing), "control socket "+missing+" does not exist, check the control-interface of Unbound")
+
+	file := filepath.Join(t.TempDir(), "file")
+	assert.Nil(t, os.WriteFile(file, nil, 0o600))
+	assert.EqualError(t, validateSocket(file), "control socket "+file+" is not a socket")
+
+	assert.ErrorContains(t, validateSocket(""), "missing path of the control socket")
+
+	// Root can write to any file
+	if os.Geteuid() != 0 {
+		assert.Nil(t, os.Chmod(path, 0o400))
+		assert.ErrorContains(t, validateSocket(path), "is not writable by the webhook")
+	}
+}
+
+func TestNewProviderSocket(t *testing.T) {
+	path, listener := newSocket(t)
+	f := &fakeControl{listener: listener, answer: func(command string) string {
+		return "version: 1.19.0\n"
+	}}
+	go f.serve()
+
+	// The TLS files are ignored for the control socket
+	p, err := NewProvider(&Configuration{Host: []string{"unix://" + path}, CaPemPath: []string{"./notexist"}, DefaultTTL: 300})
+	assert.Nil(t, err)
+	assert.Nil(t, p.Check())
+
+	missing := filepath.Join(t.TempDir(), "missing.ctl")
+	p, err = NewProvider(&Configuration{Host: []string{"unix://" + missing}})
+	assert.Nil(t, p)
+	assert.ErrorContains(t, err, "invalid Unbound host unix://"+missing+": control socket "+missing+" does not exist")
+}
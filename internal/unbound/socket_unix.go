@@ -0,0 +1,10 @@
+//go:build unix
+
+package unbound
+
+import "golang.org/x/sys/unix"
+
+// checkWritable checks that the file is writable by the process.
+func checkWritable(path string) error {
+	return unix.Access(path, unix.W_OK)
+}
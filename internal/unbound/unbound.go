@@ -2,14 +2,19 @@ package unbound
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/guillomep/external-dns-unbound-webhook/internal/metrics"
 	unboundlib "github.com/guillomep/go-unbound"
 	log "github.com/sirupsen/logrus"
 	"regexp"
 	"sigs.k8s.io/external-dns/endpoint"
 	"sigs.k8s.io/external-dns/plan"
 	"sigs.k8s.io/external-dns/provider"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 )
 
 const (
@@ -17,101 +22,338 @@ const (
 	actionRemove = "REMOVE"
 )
 
+const (
+	// FailurePolicyFail makes a batch of changes fail, and be rolled back on
+	// every instance, as soon as one instance fails.
+	FailurePolicyFail = "fail"
+	// FailurePolicyTolerate tolerates failing instances as long as one
+	// instance succeeds, the changes are retried later on the failing ones.
+	FailurePolicyTolerate = "tolerate"
+)
+
 type UnboundProvider struct {
 	provider.BaseProvider
-	client unboundlib.Client
+	instances []*instance
+	// desired contains the records each managed name must hold, as of the
+	// last successfully applied changes. It is used to repair the instances
+	// that drift from it.
+	desired map[string][]unboundlib.RR
+	// mu serializes the operations on the instances.
+	mu sync.Mutex
 
-	domainFilter *endpoint.DomainFilter
-	dryRun       bool
-	defaultTTL   int
+	domainFilter  *endpoint.DomainFilter
+	dryRun        bool
+	defaultTTL    int
+	failurePolicy string
+	// persistPath is the path of the include file the desired state is
+	// rendered into, empty if disabled.
+	persistPath    string
+	persistPending bool
+	// ptrRecords enables the management of the PTR records of the A and
+	// AAAA records, optionally restricted to reverseZones.
+	ptrRecords   bool
+	reverseZones []string
+	// localZoneType is the type of the local zones declared for the managed
+	// records, empty if disabled. zones maps the local zones declared by the
+	// provider, including the ones of the endpoints, to their type.
+	localZoneType  string
+	localZoneScope string
+	zones          map[string]string
+	// properties contains the Unbound properties of the applied endpoints.
+	properties map[rrsetKey]endpoint.ProviderSpecific
+	// views are the views the records go to instead of the global local
+	// data, unless the endpoint sets its own views.
+	views []string
+	// cacheFlush is the cache flush mode after changes, with at most
+	// cacheFlushMaxCommands commands per instance.
+	cacheFlush            string
+	cacheFlushMaxCommands int
+	// requestTimeout is the deadline of Records and ApplyChanges, unbounded
+	// if zero.
+	requestTimeout time.Duration
+}
+
+// rrsetKey identifies an RRset in Unbound.
+type rrsetKey struct {
+	name          string
+	recordType    string
+	setIdentifier string
 }
 
 type UnboundChange struct {
 	Action string
 	RR     *unboundlib.RR
+	// LocalZoneType is the type of the local zone declared for the name of
+	// the record, if any.
+	LocalZoneType string
+	// PTR enables the PTR record of an A or AAAA record.
+	PTR bool
+	// View is the view the record belongs to, empty for the global local
+	// data.
+	View string
+}
+
+// String formats the change like the records listed by Unbound, followed by
+// the view of the record, if any.
+func (c *UnboundChange) String() string {
+	if c.View == "" {
+		return fmt.Sprintf("%s\t%s", c.Action, formatRR(*c.RR))
+	}
+	return fmt.Sprintf("%s\t%s\t(view %s)", c.Action, formatRR(*c.RR), c.View)
 }
 
 // Configuration contains the Unbound provider's configuration.
 type Configuration struct {
-	Host                 string   `env:"UNBOUND_HOST" required:"true"`
-	CaPemPath            string   `env:"UNBOUND_CA_PEM_PATH" default:""`
-	KeyPemPath           string   `env:"UNBOUND_KEY_PEM_PATH" default:""`
-	CertPemPath          string   `env:"UNBOUND_CERT_PEM_PATH" default:""`
-	DryRun               bool     `env:"DRY_RUN" default:"false"`
-	DefaultTTL           int      `env:"DEFAULT_TTL" default:"300"`
-	DomainFilter         []string `env:"DOMAIN_FILTER" default:""`
-	ExcludeDomains       []string `env:"EXCLUDE_DOMAIN_FILTER" default:""`
-	RegexDomainFilter    string   `env:"REGEXP_DOMAIN_FILTER" default:""`
-	RegexDomainExclusion string   `env:"REGEXP_DOMAIN_FILTER_EXCLUSION" default:""`
+	Host                  []string `env:"UNBOUND_HOST" required:"true" yaml:"unbound_host"`
+	CaPemPath             []string `env:"UNBOUND_CA_PEM_PATH" default:"" yaml:"unbound_ca_pem_path"`
+	KeyPemPath            []string `env:"UNBOUND_KEY_PEM_PATH" default:"" yaml:"unbound_key_pem_path"`
+	CertPemPath           []string `env:"UNBOUND_CERT_PEM_PATH" default:"" yaml:"unbound_cert_pem_path"`
+	FailurePolicy         string   `env:"UNBOUND_FAILURE_POLICY" default:"fail" yaml:"unbound_failure_policy"`
+	ReconcileInterval     int      `env:"RECONCILE_INTERVAL" default:"0" yaml:"reconcile_interval"`
+	PersistPath           string   `env:"UNBOUND_PERSIST_PATH" default:"" yaml:"unbound_persist_path"`
+	PtrRecords            bool     `env:"PTR_RECORDS" default:"false" yaml:"ptr_records"`
+	ReverseZones          []string `env:"PTR_REVERSE_ZONES" default:"" yaml:"ptr_reverse_zones"`
+	LocalZoneType         string   `env:"UNBOUND_LOCAL_ZONE_TYPE" default:"" yaml:"unbound_local_zone_type"`
+	LocalZoneScope        string   `env:"UNBOUND_LOCAL_ZONE_SCOPE" default:"domain" yaml:"unbound_local_zone_scope"`
+	Views                 []string `env:"UNBOUND_VIEWS" default:"" yaml:"unbound_views"`
+	CacheFlush            string   `env:"UNBOUND_CACHE_FLUSH" default:"none" yaml:"unbound_cache_flush"`
+	CacheFlushMaxCommands int      `env:"UNBOUND_CACHE_FLUSH_MAX_COMMANDS" default:"100" yaml:"unbound_cache_flush_max_commands"`
+	BulkSize              int      `env:"UNBOUND_BULK_SIZE" default:"0" yaml:"unbound_bulk_size"`
+	SnapshotInterval      int      `env:"UNBOUND_SNAPSHOT_INTERVAL" default:"0" yaml:"unbound_snapshot_interval"`
+	RetryAttempts         int      `env:"UNBOUND_RETRY_ATTEMPTS" default:"3" yaml:"unbound_retry_attempts"`
+	RetryBackoff          int      `env:"UNBOUND_RETRY_BACKOFF" default:"100" yaml:"unbound_retry_backoff"`
+	RetryMaxBackoff       int      `env:"UNBOUND_RETRY_MAX_BACKOFF" default:"5000" yaml:"unbound_retry_max_backoff"`
+	AttemptTimeout        int      `env:"UNBOUND_ATTEMPT_TIMEOUT" default:"10000" yaml:"unbound_attempt_timeout"`
+	RequestTimeout        int      `env:"UNBOUND_REQUEST_TIMEOUT" default:"0" yaml:"unbound_request_timeout"`
+	TLSReloadInterval     int      `env:"UNBOUND_TLS_RELOAD_INTERVAL" default:"0" yaml:"unbound_tls_reload_interval"`
+	DryRun                bool     `env:"DRY_RUN" default:"false" yaml:"dry_run"`
+	DefaultTTL            int      `env:"DEFAULT_TTL" default:"300" yaml:"default_ttl"`
+	DomainFilter          []string `env:"DOMAIN_FILTER" default:"" yaml:"domain_filter"`
+	ExcludeDomains        []string `env:"EXCLUDE_DOMAIN_FILTER" default:"" yaml:"exclude_domain_filter"`
+	RegexDomainFilter     string   `env:"REGEXP_DOMAIN_FILTER" default:"" yaml:"regexp_domain_filter"`
+	RegexDomainExclusion  string   `env:"REGEXP_DOMAIN_FILTER_EXCLUSION" default:"" yaml:"regexp_domain_filter_exclusion"`
 }
 
 func NewProvider(config *Configuration) (*UnboundProvider, error) {
-	unboundClient, err := unboundlib.NewClient(config.Host,
-		unboundlib.WithServerCertificatesFile(config.CaPemPath),
-		unboundlib.WithControlPrivateKeyFile(config.KeyPemPath),
-		unboundlib.WithControlCertificatesFile(config.CertPemPath))
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	var views []string
+	if len(config.Views) > 0 {
+		var err error
+		if views, err = parseViews(strings.Join(config.Views, ",")); err != nil {
+			return nil, err
+		}
+	}
+
+	domainFilter, err := GetDomainFilter(*config)
 	if err != nil {
 		return nil, err
 	}
 
-	return &UnboundProvider{
-		client:       unboundClient,
-		dryRun:       config.DryRun,
-		defaultTTL:   config.DefaultTTL,
-		domainFilter: GetDomainFilter(*config),
-	}, nil
-}
+	instances := make([]*instance, 0, len(config.Host))
+	for i, host := range config.Host {
+		files, err := config.certificateFiles(i)
+		if err != nil {
+			return nil, err
+		}
 
-// Records returns the list of records.
-func (p *UnboundProvider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
-	endpoints := []*endpoint.Endpoint{}
+		var opts []unboundlib.OptionFn
+		if _, ok := socketPath(host); ok {
+			// Unbound does not use TLS on its control socket, which is
+			// protected by its permissions
+			if !files.empty() {
+				log.WithField("host", host).Info("Ignoring the TLS files for the control socket.")
+				files = certificateFiles{}
+			}
+		} else {
+			opts = files.options()
+		}
 
-	records := p.client.LocalData()
+		unboundClient, err := newControlClient(host, opts...)
+		if err != nil {
+			return nil, err
+		}
 
-	for _, r := range records {
-		if provider.SupportedRecordType(r.Type) {
-			if !p.domainFilter.Match(r.Name) {
-				continue
+		var certificates *certificateReloader
+		if !files.empty() {
+			if certificates, err = newCertificateReloader(host, files, unboundClient); err != nil {
+				return nil, err
 			}
+		}
 
-			endpoints = append(endpoints, endpoint.NewEndpointWithTTL(r.Name, r.Type, endpoint.TTL(r.TTL), r.Value))
+		instances = append(instances, &instance{
+			host:             host,
+			client:           &instrumentedClient{host: host, client: unboundClient},
+			bulkSize:         config.BulkSize,
+			snapshotInterval: config.GetSnapshotInterval(),
+			retry:            config.getRetryPolicy(),
+			certificates:     certificates,
+		})
+	}
+
+	p := &UnboundProvider{
+		instances:             instances,
+		dryRun:                config.DryRun,
+		defaultTTL:            config.DefaultTTL,
+		failurePolicy:         config.FailurePolicy,
+		persistPath:           config.PersistPath,
+		ptrRecords:            config.PtrRecords,
+		reverseZones:          config.ReverseZones,
+		localZoneType:         config.LocalZoneType,
+		localZoneScope:        config.LocalZoneScope,
+		views:                 views,
+		cacheFlush:            config.CacheFlush,
+		cacheFlushMaxCommands: config.CacheFlushMaxCommands,
+		requestTimeout:        config.GetRequestTimeout(),
+		domainFilter:          domainFilter,
+	}
+
+	// The local zones declared before a restart are still removed once they
+	// no longer hold managed records
+	if p.persistPath != "" {
+		if p.zones, err = p.persistedZones(); err != nil {
+			return nil, err
 		}
 	}
+	return p, nil
+}
 
-	return endpoints, nil
+// GetReconcileInterval returns the interval between two reconciliations, zero
+// if the reconciliation is disabled.
+func (c Configuration) GetReconcileInterval() time.Duration {
+	return time.Duration(c.ReconcileInterval) * time.Millisecond
 }
 
-func (p *UnboundProvider) submitChanges(changes []*UnboundChange) error {
-	if len(changes) == 0 {
-		log.Infof("All records are already up to date")
-		return nil
+// GetSnapshotInterval returns the interval between two dumps of the records
+// read by Records, zero if the records are dumped on every call.
+func (c Configuration) GetSnapshotInterval() time.Duration {
+	return time.Duration(c.SnapshotInterval) * time.Millisecond
+}
+
+// GetTLSReloadInterval returns the interval between two checks of the TLS
+// files, zero if they are only read at startup.
+func (c Configuration) GetTLSReloadInterval() time.Duration {
+	return time.Duration(c.TLSReloadInterval) * time.Millisecond
+}
+
+// GetRequestTimeout returns the deadline of the requests of ExternalDNS, zero
+// if they are only bounded by ExternalDNS.
+func (c Configuration) GetRequestTimeout() time.Duration {
+	return time.Duration(c.RequestTimeout) * time.Millisecond
+}
+
+// getRetryPolicy returns the retry policy of the commands sent to the
+// instances.
+func (c Configuration) getRetryPolicy() retryPolicy {
+	return retryPolicy{
+		attempts:       c.RetryAttempts,
+		backoff:        time.Duration(c.RetryBackoff) * time.Millisecond,
+		maxBackoff:     time.Duration(c.RetryMaxBackoff) * time.Millisecond,
+		attemptTimeout: time.Duration(c.AttemptTimeout) * time.Millisecond,
 	}
+}
 
-	for _, change := range changes {
-		log.WithFields(log.Fields{
-			"record": change.RR.Name,
-			"type":   change.RR.Type,
-			"ttl":    change.RR.TTL,
-			"action": change.Action,
-		}).Info("Changing record.")
+// instancePath returns the path of the i-th instance. A single path is shared
+// by all the instances, otherwise there must be one path per instance.
+func instancePath(paths []string, i, instances int) (string, error) {
+	switch len(paths) {
+	case 0:
+		return "", nil
+	case 1:
+		return paths[0], nil
+	case instances:
+		return paths[i], nil
+	default:
+		return "", fmt.Errorf("expected 1 or %d paths, got %d", instances, len(paths))
+	}
+}
 
-		if p.dryRun {
-			continue
-		}
+// Records returns the list of records of all the instances. Resource records
+// sharing the same name and type are grouped into a single endpoint with
+// multiple targets. PTR records, including the generated ones, are not
+// reported since they are not managed by ExternalDNS.
+func (p *UnboundProvider) Records(ctx context.Context) (endpoints []*endpoint.Endpoint, err error) {
+	defer func(start time.Time) { metrics.ObserveProviderCall("Records", start, err) }(time.Now())
 
-		switch change.Action {
-		case actionCreate:
-			if err := p.client.AddLocalData(*change.RR); err != nil {
-				return err
+	ctx, cancel := p.requestContext(ctx)
+	defer cancel()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.retryPending(ctx)
+	divergent := make([]int, len(p.instances))
+	records, err := p.localData(ctx, "", divergent)
+	if err != nil {
+		return nil, err
+	}
+	viewEndpoints, err := p.viewEndpoints(ctx, divergent)
+	if err != nil {
+		return nil, err
+	}
+
+	// Incomplete records must not be reported, ExternalDNS would plan to
+	// create the missing ones
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if p.desired == nil && len(records) > 0 {
+		p.initDesired(records)
+		p.persist()
+	} else if p.persistPending {
+		p.persist()
+	}
+
+	endpoints = append(p.endpoints(records), viewEndpoints...)
+	for _, ep := range endpoints {
+		ep.ProviderSpecific = p.endpointProperties(ep)
+	}
+
+	p.updateDivergentRecords(divergent)
+	p.updateSnapshotAge()
+	p.updateManagedRecords(endpoints)
+	return endpoints, nil
+}
+
+// endpoints groups the records of the managed domains into endpoints. A
+// record held by several instances with different TTLs is a single target.
+func (p *UnboundProvider) endpoints(records []unboundlib.RR) []*endpoint.Endpoint {
+	endpoints := []*endpoint.Endpoint{}
+	rrsets := map[rrsetKey]*endpoint.Endpoint{}
+
+	for _, r := range records {
+		if provider.SupportedRecordType(r.Type) {
+			if !p.domainFilter.Match(r.Name) {
+				continue
+			}
+
+			key := rrsetKey{name: r.Name, recordType: r.Type}
+			ep, ok := rrsets[key]
+			if !ok {
+				ep = endpoint.NewEndpointWithTTL(r.Name, r.Type, endpoint.TTL(r.TTL), r.Value)
+				rrsets[key] = ep
+				endpoints = append(endpoints, ep)
+				continue
 			}
-		case actionRemove:
-			if err := p.client.RemoveLocalData(*change.RR); err != nil {
-				return err
+
+			// An RRset must share a single TTL, keep the lowest one if Unbound
+			// reports several of them.
+			if ttl := endpoint.TTL(r.TTL); ttl != ep.RecordTTL {
+				log.WithFields(log.Fields{
+					"record": r.Name,
+					"type":   r.Type,
+				}).Debugf("RRset has different TTLs (%d and %d), keeping the lowest.", ep.RecordTTL, ttl)
+				ep.RecordTTL = min(ep.RecordTTL, ttl)
+			}
+			if !slices.Contains(ep.Targets, r.Value) {
+				ep.Targets = append(ep.Targets, r.Value)
 			}
 		}
 	}
 
-	return nil
+	return endpoints
 }
 
 func (p *UnboundProvider) newUnboundChange(action string, endpoints []*endpoint.Endpoint) []*UnboundChange {
@@ -124,25 +366,37 @@ func (p *UnboundProvider) newUnboundChange(action string, endpoints []*endpoint.
 			ttl = p.defaultTTL
 		}
 
-		for _, t := range e.Targets {
-			change := &UnboundChange{
-				Action: action,
-				RR: &unboundlib.RR{
-					Name:  e.DNSName,
-					TTL:   ttl,
-					Type:  e.RecordType,
-					Value: t,
-				},
-			}
+		localZoneType, _ := e.GetProviderSpecificProperty(PropertyLocalZoneType)
+		ptr := p.ptrRecords
+		if value, ok := e.GetProviderSpecificProperty(PropertyPTR); ok {
+			ptr = value == "true"
+		}
+
+		for _, view := range p.endpointViews(e) {
+			for _, t := range e.Targets {
+				change := &UnboundChange{
+					Action: action,
+					RR: &unboundlib.RR{
+						Name:  e.DNSName,
+						TTL:   ttl,
+						Type:  e.RecordType,
+						Value: t,
+					},
+					LocalZoneType: localZoneType,
+					PTR:           ptr,
+					View:          view,
+				}
 
-			changes = append(changes, change)
+				changes = append(changes, change)
+			}
 		}
 	}
 	return changes
 }
 
-// ApplyChanges applies a given set of changes in a given zone.
-func (p *UnboundProvider) ApplyChanges(ctx context.Context, changes *plan.Changes) error {
+// PlanChanges returns the changes of the records ApplyChanges sends to the
+// instances for the changes planned by ExternalDNS, including the PTR records.
+func (p *UnboundProvider) PlanChanges(changes *plan.Changes) []*UnboundChange {
 	combinedChanges := make([]*UnboundChange, 0, len(changes.Create)+len(changes.UpdateNew)+len(changes.Delete))
 
 	combinedChanges = append(combinedChanges, p.newUnboundChange(actionCreate, changes.Create)...)
@@ -150,23 +404,242 @@ func (p *UnboundProvider) ApplyChanges(ctx context.Context, changes *plan.Change
 	combinedChanges = append(combinedChanges, p.newUnboundChange(actionCreate, changes.UpdateNew)...)
 	combinedChanges = append(combinedChanges, p.newUnboundChange(actionRemove, changes.Delete)...)
 
-	return p.submitChanges(combinedChanges)
+	return append(combinedChanges, p.ptrChanges(combinedChanges)...)
+}
+
+// ApplyChanges applies a given set of changes in a given zone.
+func (p *UnboundProvider) ApplyChanges(ctx context.Context, changes *plan.Changes) (err error) {
+	defer func(start time.Time) { metrics.ObserveProviderCall("ApplyChanges", start, err) }(time.Now())
+
+	combinedChanges := p.PlanChanges(changes)
+	if len(combinedChanges) == 0 {
+		log.Infof("All records are already up to date")
+		return nil
+	}
+
+	for _, change := range combinedChanges {
+		log.WithFields(log.Fields{
+			"record": change.RR.Name,
+			"type":   change.RR.Type,
+			"ttl":    change.RR.TTL,
+			"action": change.Action,
+		}).Info("Changing record.")
+	}
+
+	if p.dryRun {
+		return nil
+	}
+
+	ctx, cancel := p.requestContext(ctx)
+	defer cancel()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// The request may have been abandoned while waiting for the previous one
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := p.submitChanges(ctx, combinedChanges); err != nil {
+		return err
+	}
+	p.updateProperties(changes)
+	p.flushCache(ctx, combinedChanges)
+
+	for _, change := range combinedChanges {
+		metrics.RecordChanges.WithLabelValues(strings.ToLower(change.Action)).Inc()
+	}
+	return nil
+}
+
+// requestContext returns the context of a request of ExternalDNS, bounded by
+// the request timeout.
+func (p *UnboundProvider) requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.requestTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, p.requestTimeout)
+}
+
+// submitChanges applies the changes on every instance, after the changes
+// still pending on it. All the instances are read before any change, so that
+// the same desired records are applied on each of them. Depending on the
+// failure policy, a failing instance either makes the whole batch fail and be
+// rolled back on the other instances, or is tolerated and the changes are kept
+// pending on it. A batch whose context is done is aborted and rolled back
+// whatever the policy.
+func (p *UnboundProvider) submitChanges(ctx context.Context, changes []*UnboundChange) error {
+	transactions := make([]*transaction, len(p.instances))
+	instanceChanges := make([][]*UnboundChange, len(p.instances))
+	snapshots := make([]map[string][]unboundlib.RR, len(p.instances))
+	errs := []error{}
+
+	for i, inst := range p.instances {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+
+		instanceChanges[i] = append(append([]*UnboundChange{}, inst.pending...), changes...)
+		snapshot, err := inst.snapshot(ctx, changeViews(instanceChanges[i]))
+		if err != nil {
+			inst.invalidateCache()
+			errs = append(errs, fmt.Errorf("unbound instance %s: %w", inst.host, err))
+			continue
+		}
+		snapshots[i] = snapshot
+	}
+	// Nothing was modified yet
+	if len(errs) > 0 && !p.tolerated(ctx, errs) {
+		return errors.Join(errs...)
+	}
+	current := p.currentRecords(slices.Concat(instanceChanges...), snapshots...)
+
+	for i, inst := range p.instances {
+		if snapshots[i] == nil {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+
+		if err := p.declareZones(ctx, inst, p.createdZones(instanceChanges[i])); err != nil {
+			errs = append(errs, fmt.Errorf("unbound instance %s: %w", inst.host, err))
+			continue
+		}
+		tx, err := inst.submitChanges(ctx, instanceChanges[i], snapshots[i], current)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unbound instance %s: %w", inst.host, err))
+			continue
+		}
+		transactions[i] = tx
+		inst.pending = nil
+	}
+
+	if len(errs) == 0 {
+		p.updateDesired(transactions)
+		p.cleanupZones(ctx)
+		p.persist()
+		return nil
+	}
+
+	if p.tolerated(ctx, errs) {
+		p.updateDesired(transactions)
+		p.cleanupZones(ctx)
+		p.persist()
+		for i, inst := range p.instances {
+			if transactions[i] == nil {
+				inst.pending = instanceChanges[i]
+				log.WithField("instance", inst.host).Warnf("Changes will be retried later: %d pending changes", len(inst.pending))
+			}
+		}
+		log.Warnf("Tolerating failing Unbound instances: %v", errors.Join(errs...))
+		return nil
+	}
+
+	for i, tx := range transactions {
+		if tx != nil {
+			err := p.instances[i].rollback(ctx, tx, fmt.Errorf("changes failed on another instance"))
+			errs = append(errs, fmt.Errorf("unbound instance %s: %w", p.instances[i].host, err))
+		}
+	}
+	p.cleanupZones(context.WithoutCancel(ctx))
+
+	return errors.Join(errs...)
+}
+
+// tolerated returns true if the failing instances are tolerated: the failure
+// policy tolerates them, at least one instance succeeded and the context is
+// not done.
+func (p *UnboundProvider) tolerated(ctx context.Context, errs []error) bool {
+	return p.failurePolicy == FailurePolicyTolerate && len(errs) < len(p.instances) && ctx.Err() == nil
+}
+
+// retryPending applies the changes still pending on the instances.
+func (p *UnboundProvider) retryPending(ctx context.Context) {
+	for _, inst := range p.instances {
+		if len(inst.pending) == 0 {
+			continue
+		}
+
+		if err := p.declareZones(ctx, inst, p.createdZones(inst.pending)); err != nil {
+			log.WithField("instance", inst.host).Warnf("Could not apply pending changes: %v", err)
+			continue
+		}
+		snapshot, err := inst.snapshot(ctx, changeViews(inst.pending))
+		if err != nil {
+			inst.invalidateCache()
+			log.WithField("instance", inst.host).Warnf("Could not apply pending changes: %v", err)
+			continue
+		}
+		if _, err := inst.submitChanges(ctx, inst.pending, snapshot, p.currentRecords(inst.pending, snapshot)); err != nil {
+			log.WithField("instance", inst.host).Warnf("Could not apply pending changes: %v", err)
+			continue
+		}
+		log.WithField("instance", inst.host).Infof("Applied %d pending changes", len(inst.pending))
+		inst.pending = nil
+	}
+}
+
+// InstanceStatus is the result of the check of an instance.
+type InstanceStatus struct {
+	Host string
+	// Err is nil if the instance answers on its control channel.
+	Err error
+}
+
+// CheckInstances checks that every instance answers on its control channel.
+func (p *UnboundProvider) CheckInstances() []InstanceStatus {
+	statuses := make([]InstanceStatus, 0, len(p.instances))
+	for _, inst := range p.instances {
+		statuses = append(statuses, InstanceStatus{Host: inst.host, Err: inst.client.Status()})
+	}
+	return statuses
+}
+
+// Check checks that the instances answer on their control channel. With the
+// tolerate failure policy, a single available instance is enough.
+func (p *UnboundProvider) Check() error {
+	errs := []error{}
+	for _, status := range p.CheckInstances() {
+		if status.Err != nil {
+			errs = append(errs, fmt.Errorf("unbound instance %s is not reachable: %w", status.Host, status.Err))
+		}
+	}
+
+	if p.failurePolicy == FailurePolicyTolerate && len(errs) < len(p.instances) {
+		return nil
+	}
+	return errors.Join(errs...)
+}
+
+// GetDomainFilter returns the domain filter of the provider, so ExternalDNS
+// only plans changes for the domains managed by the webhook.
+func (p *UnboundProvider) GetDomainFilter() endpoint.DomainFilterInterface {
+	return p.domainFilter
 }
 
 func (p *UnboundProvider) AdjustEndpoints(endpoints []*endpoint.Endpoint) ([]*endpoint.Endpoint, error) {
+	defer func(start time.Time) { metrics.ObserveProviderCall("AdjustEndpoints", start, nil) }(time.Now())
+
 	adjustedEndpoints := []*endpoint.Endpoint{}
 
 	for _, ep := range endpoints {
 		if !strings.HasSuffix(ep.DNSName, ".") {
 			ep.DNSName = ep.DNSName + "."
 		}
+		p.adjustProperties(ep)
 		adjustedEndpoints = append(adjustedEndpoints, ep)
 	}
 
 	return adjustedEndpoints, nil
 }
 
-func GetDomainFilter(config Configuration) *endpoint.DomainFilter {
+// GetDomainFilter returns the domain filter of the configuration, or an error
+// if one of its regular expressions does not compile.
+func GetDomainFilter(config Configuration) (*endpoint.DomainFilter, error) {
 	var domainFilter *endpoint.DomainFilter
 	createMsg := "Creating Unbound provider with "
 
@@ -175,10 +648,15 @@ func GetDomainFilter(config Configuration) *endpoint.DomainFilter {
 		if config.RegexDomainExclusion != "" {
 			createMsg += fmt.Sprintf("with exclusion: '%s', ", config.RegexDomainExclusion)
 		}
-		domainFilter = endpoint.NewRegexDomainFilter(
-			regexp.MustCompile(config.RegexDomainFilter),
-			regexp.MustCompile(config.RegexDomainExclusion),
-		)
+		regexFilter, err := regexp.Compile(config.RegexDomainFilter)
+		if err != nil {
+			return nil, invalidSetting("REGEXP_DOMAIN_FILTER", "invalid regular expression: %w", err)
+		}
+		regexExclusion, err := regexp.Compile(config.RegexDomainExclusion)
+		if err != nil {
+			return nil, invalidSetting("REGEXP_DOMAIN_FILTER_EXCLUSION", "invalid regular expression: %w", err)
+		}
+		domainFilter = endpoint.NewRegexDomainFilter(regexFilter, regexExclusion)
 	} else {
 		if len(config.DomainFilter) > 0 {
 			createMsg += fmt.Sprintf("Domain filter: '%s', ", strings.Join(config.DomainFilter, ","))
@@ -194,5 +672,5 @@ func GetDomainFilter(config Configuration) *endpoint.DomainFilter {
 		createMsg += "no kind of domain filters"
 	}
 	log.Info(createMsg)
-	return domainFilter
+	return domainFilter, nil
 }
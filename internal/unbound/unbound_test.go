@@ -2,39 +2,250 @@ package unbound
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/codingconcepts/env"
 	unboundlib "github.com/guillomep/go-unbound"
 	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
 	"sigs.k8s.io/external-dns/endpoint"
 	"sigs.k8s.io/external-dns/plan"
+	"sigs.k8s.io/external-dns/provider/webhook/api"
 	"testing"
+	"time"
 )
 
 // Compile time check for interface conformance
-var _ unboundlib.Client = &mockClient{}
+var _ Client = &mockClient{}
 
 type mockClient struct {
 	records []unboundlib.RR
+	// failOn returns the error a command must fail with, if any.
+	failOn func(action string, rr unboundlib.RR) error
+	// statusErr is the error returned by Status.
+	statusErr error
+	// zones maps the local zones to their type.
+	zones map[string]string
+	// views maps the views to their records.
+	views map[string][]unboundlib.RR
+	// flushed contains the cache flush commands.
+	flushed []string
+	// commands counts the commands modifying records.
+	commands int
+	// dumps counts the commands reading records.
+	dumps int
+	// dumpErr is the error returned by ListLocalData.
+	dumpErr error
 }
 
-func (m *mockClient) LocalData() []unboundlib.RR {
-	return m.records
+func (m *mockClient) Status() error {
+	return m.statusErr
+}
+
+func (m *mockClient) LocalZones() ([]LocalZone, error) {
+	zones := []LocalZone{}
+	for name, zoneType := range m.zones {
+		zones = append(zones, LocalZone{Name: name + ".", Type: zoneType})
+	}
+	return zones, nil
+}
+
+func (m *mockClient) AddLocalZone(name, zoneType string) error {
+	if m.failOn != nil {
+		if err := m.failOn("local_zone", unboundlib.RR{Name: name}); err != nil {
+			return err
+		}
+	}
+	if m.zones == nil {
+		m.zones = map[string]string{}
+	}
+	m.zones[name] = zoneType
+	return nil
+}
+
+func (m *mockClient) RemoveLocalZone(name string) error {
+	delete(m.zones, name)
+	return nil
+}
+
+func (m *mockClient) AddLocalDatas(records []unboundlib.RR) error {
+	m.commands++
+	for _, rr := range records {
+		if err := m.addLocalData(rr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mockClient) RemoveLocalDatas(names []string) error {
+	m.commands++
+	for _, name := range names {
+		if err := m.removeLocalData(unboundlib.RR{Name: name}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mockClient) AddViewLocalDatas(view string, records []unboundlib.RR) error {
+	m.commands++
+	if _, ok := m.views[view]; !ok {
+		return errNoView("view_local_datas", view)
+	}
+	for _, rr := range records {
+		if err := m.addViewLocalData(view, rr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mockClient) RemoveViewLocalDatas(view string, names []string) error {
+	m.commands++
+	if _, ok := m.views[view]; !ok {
+		return errNoView("view_local_datas_remove", view)
+	}
+	for _, name := range names {
+		if err := m.removeViewLocalData(view, unboundlib.RR{Name: name}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mockClient) Flush(name string) error {
+	m.flushed = append(m.flushed, "flush "+name)
+	return nil
+}
+
+func (m *mockClient) FlushType(name, recordType string) error {
+	m.flushed = append(m.flushed, fmt.Sprintf("flush_type %s %s", name, recordType))
+	return nil
+}
+
+func (m *mockClient) FlushZone(name string) error {
+	m.flushed = append(m.flushed, "flush_zone "+name)
+	return nil
+}
+
+func (m *mockClient) ViewLocalData(view string) ([]unboundlib.RR, error) {
+	m.dumps++
+	records, ok := m.views[view]
+	if !ok {
+		return nil, errNoView("view_list_local_data", view)
+	}
+	return records, nil
+}
+
+// errNoView returns the error of the control client when Unbound answers that
+// the view of a command does not exist.
+func errNoView(command, view string) error {
+	return fmt.Errorf("%s: no view with name: %s", command, view)
+}
+
+func (m *mockClient) AddViewLocalData(view string, rr unboundlib.RR) error {
+	m.commands++
+	if _, ok := m.views[view]; !ok {
+		return errNoView("view_local_data", view)
+	}
+	return m.addViewLocalData(view, rr)
+}
+
+func (m *mockClient) addViewLocalData(view string, rr unboundlib.RR) error {
+	if m.failOn != nil {
+		if err := m.failOn(actionCreate, rr); err != nil {
+			return err
+		}
+	}
+	m.views[view] = append(m.views[view], rr)
+	return nil
+}
+
+func (m *mockClient) RemoveViewLocalData(view string, rr unboundlib.RR) error {
+	m.commands++
+	if _, ok := m.views[view]; !ok {
+		return errNoView("view_local_data_remove", view)
+	}
+	return m.removeViewLocalData(view, rr)
+}
+
+func (m *mockClient) removeViewLocalData(view string, rr unboundlib.RR) error {
+	records := []unboundlib.RR{}
+	for _, r := range m.views[view] {
+		if canonicalName(r.Name) != canonicalName(rr.Name) {
+			records = append(records, r)
+		}
+	}
+	m.views[view] = records
+	return nil
+}
+
+func (m *mockClient) ListLocalData() ([]unboundlib.RR, error) {
+	m.dumps++
+	if m.dumpErr != nil {
+		return nil, m.dumpErr
+	}
+	return m.records, nil
 }
 
 func (m *mockClient) AddLocalData(rr unboundlib.RR) error {
+	m.commands++
+	return m.addLocalData(rr)
+}
+
+func (m *mockClient) addLocalData(rr unboundlib.RR) error {
+	if m.failOn != nil {
+		if err := m.failOn(actionCreate, rr); err != nil {
+			return err
+		}
+	}
 	m.records = append(m.records, rr)
 	return nil
 }
 
+// RemoveLocalData removes all the records of the name, like Unbound does.
 func (m *mockClient) RemoveLocalData(rr unboundlib.RR) error {
-	for i, r := range m.records {
-		if r == rr {
-			m.records = append(m.records[:i], m.records[i+1:]...)
+	m.commands++
+	return m.removeLocalData(rr)
+}
+
+func (m *mockClient) removeLocalData(rr unboundlib.RR) error {
+	if m.failOn != nil {
+		if err := m.failOn(actionRemove, rr); err != nil {
+			return err
+		}
+	}
+	records := []unboundlib.RR{}
+	for _, r := range m.records {
+		if canonicalName(r.Name) != canonicalName(rr.Name) {
+			records = append(records, r)
 		}
 	}
+	m.records = records
 	return nil
 }
 
+// testDomainFilter returns the domain filter of the configuration, failing the
+// test if it is invalid.
+func testDomainFilter(t *testing.T, config Configuration) *endpoint.DomainFilter {
+	domainFilter, err := GetDomainFilter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return domainFilter
+}
+
+// testInstances returns one instance per client.
+func testInstances(clients ...Client) []*instance {
+	instances := make([]*instance, 0, len(clients))
+	for i, c := range clients {
+		instances = append(instances, &instance{host: fmt.Sprintf("unbound-%d", i), client: c})
+	}
+	return instances
+}
+
 func TestConfigurationDefault(t *testing.T) {
 	config := Configuration{}
 	t.Setenv("UNBOUND_HOST", "testhost")
@@ -42,10 +253,11 @@ func TestConfigurationDefault(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	assert.Equal(t, config.Host, "testhost")
+	assert.Equal(t, config.Host, []string{"testhost"})
 	assert.Empty(t, config.CaPemPath)
 	assert.Empty(t, config.KeyPemPath)
 	assert.Empty(t, config.CertPemPath)
+	assert.Equal(t, FailurePolicyFail, config.FailurePolicy)
 	assert.False(t, config.DryRun)
 	assert.Equal(t, 300, config.DefaultTTL)
 	assert.Empty(t, config.DomainFilter)
@@ -62,18 +274,52 @@ func TestConfigurationHostRequired(t *testing.T) {
 }
 
 func TestNewProvider(t *testing.T) {
-	p, err := NewProvider(&Configuration{CaPemPath: "./notexist", KeyPemPath: "./notexist", CertPemPath: "./notexist"})
+	p, err := NewProvider(&Configuration{Host: []string{"testing"}, CaPemPath: []string{"./notexist"}, KeyPemPath: []string{"./notexist"}, CertPemPath: []string{"./notexist"}})
 	assert.Nil(t, p)
 	assert.NotNil(t, err)
 
-	p, err = NewProvider(&Configuration{Host: "testing", DryRun: true})
+	p, err = NewProvider(&Configuration{Host: []string{"testing"}, DryRun: true, DefaultTTL: 300})
 	assert.NotNil(t, p)
 	assert.Nil(t, err)
-	assert.NotNil(t, p.client)
+	assert.Len(t, p.instances, 1)
+	assert.NotNil(t, p.instances[0].client)
 	assert.True(t, p.dryRun)
 	assert.NotNil(t, p.domainFilter)
 }
 
+func TestNewProviderInstances(t *testing.T) {
+	p, err := NewProvider(&Configuration{Host: []string{"tcp://unbound-1:8953", "tcp://unbound-2:8953"}, FailurePolicy: FailurePolicyTolerate, DefaultTTL: 300})
+	assert.Nil(t, err)
+	assert.Len(t, p.instances, 2)
+	assert.Equal(t, "tcp://unbound-1:8953", p.instances[0].host)
+	assert.Equal(t, "tcp://unbound-2:8953", p.instances[1].host)
+	assert.Equal(t, FailurePolicyTolerate, p.failurePolicy)
+
+	p, err = NewProvider(&Configuration{})
+	assert.Nil(t, p)
+	assert.NotNil(t, err)
+
+	p, err = NewProvider(&Configuration{Host: []string{"testing"}, FailurePolicy: "unknown"})
+	assert.Nil(t, p)
+	assert.NotNil(t, err)
+
+	p, err = NewProvider(&Configuration{Host: []string{"unbound-1", "unbound-2", "unbound-3"}, CaPemPath: []string{"./notexist", "./notexist"}})
+	assert.Nil(t, p)
+	assert.ErrorContains(t, err, "expected 1 or 3 paths, got 2")
+
+	p, err = NewProvider(&Configuration{Host: []string{"testing"}, BulkSize: -1})
+	assert.Nil(t, p)
+	assert.ErrorContains(t, err, "bulk size must not be negative, got -1")
+
+	p, err = NewProvider(&Configuration{Host: []string{"testing"}, SnapshotInterval: -1})
+	assert.Nil(t, p)
+	assert.ErrorContains(t, err, "snapshot interval must not be negative, got -1")
+
+	p, err = NewProvider(&Configuration{Host: []string{"testing"}, RequestTimeout: -1})
+	assert.Nil(t, p)
+	assert.ErrorContains(t, err, "request timeout must not be negative, got -1")
+}
+
 func TestRecords(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -152,13 +398,58 @@ func TestRecords(t *testing.T) {
 				RegexDomainExclusion: "^a.*",
 			},
 		},
+		{
+			name: "with multi-target records",
+			records: []unboundlib.RR{
+				{Name: "test.lan", TTL: 300, Type: "A", Value: "192.168.1.1"},
+				{Name: "a.example.com", TTL: 3600, Type: "CNAME", Value: "abc.def"},
+				{Name: "test.lan", TTL: 300, Type: "A", Value: "192.168.1.2"},
+				{Name: "test.lan", TTL: 300, Type: "TXT", Value: "\"heritage=external-dns\""},
+				{Name: "test.lan", TTL: 300, Type: "A", Value: "192.168.1.3"},
+			},
+			expected: []*endpoint.Endpoint{
+				endpoint.NewEndpointWithTTL("test.lan", "A", endpoint.TTL(300), "192.168.1.1", "192.168.1.2", "192.168.1.3"),
+				endpoint.NewEndpointWithTTL("a.example.com", "CNAME", endpoint.TTL(3600), "abc.def"),
+				endpoint.NewEndpointWithTTL("test.lan", "TXT", endpoint.TTL(300), "\"heritage=external-dns\""),
+			},
+			config: Configuration{},
+		},
+		{
+			name: "with multi-target records with different ttl",
+			records: []unboundlib.RR{
+				{Name: "test.lan", TTL: 600, Type: "A", Value: "192.168.1.1"},
+				{Name: "test.lan", TTL: 300, Type: "A", Value: "192.168.1.2"},
+				{Name: "test.lan", TTL: 900, Type: "A", Value: "192.168.1.3"},
+				{Name: "test.lan", TTL: 300, Type: "AAAA", Value: "fd00::1"},
+			},
+			expected: []*endpoint.Endpoint{
+				endpoint.NewEndpointWithTTL("test.lan", "A", endpoint.TTL(300), "192.168.1.1", "192.168.1.2", "192.168.1.3"),
+				endpoint.NewEndpointWithTTL("test.lan", "AAAA", endpoint.TTL(300), "fd00::1"),
+			},
+			config: Configuration{},
+		},
+		{
+			name: "with multi-target records with domain filter",
+			records: []unboundlib.RR{
+				{Name: "test.lan", TTL: 300, Type: "A", Value: "192.168.1.1"},
+				{Name: "a.example.com", TTL: 300, Type: "A", Value: "192.168.1.1"},
+				{Name: "test.lan", TTL: 300, Type: "A", Value: "192.168.1.2"},
+				{Name: "a.example.com", TTL: 300, Type: "A", Value: "192.168.1.2"},
+			},
+			expected: []*endpoint.Endpoint{
+				endpoint.NewEndpointWithTTL("a.example.com", "A", endpoint.TTL(300), "192.168.1.1", "192.168.1.2"),
+			},
+			config: Configuration{
+				DomainFilter: []string{"example.com"},
+			},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			p := &UnboundProvider{
-				client:       &mockClient{records: tt.records},
-				domainFilter: GetDomainFilter(tt.config),
+				instances:    testInstances(&mockClient{records: tt.records}),
+				domainFilter: testDomainFilter(t, tt.config),
 			}
 
 			result, err := p.Records(context.TODO())
@@ -295,13 +586,102 @@ func TestApplyChange(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "record delete keeps other types",
+			records: []unboundlib.RR{
+				{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+				{Name: "test.lan.", TTL: 300, Type: "TXT", Value: "\"heritage=external-dns\""},
+				{Name: "a.example.com.", TTL: 3600, Type: "CNAME", Value: "abc.def"},
+			},
+			expected: []unboundlib.RR{
+				{Name: "a.example.com.", TTL: 3600, Type: "CNAME", Value: "abc.def"},
+				{Name: "test.lan.", TTL: 300, Type: "TXT", Value: "\"heritage=external-dns\""},
+			},
+			changes: plan.Changes{
+				Delete: []*endpoint.Endpoint{
+					endpoint.NewEndpointWithTTL("test.lan.", "A", endpoint.TTL(300), "192.168.1.1"),
+				},
+			},
+		},
+		{
+			name: "record delete one target",
+			records: []unboundlib.RR{
+				{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+				{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.2"},
+				{Name: "test.lan.", TTL: 300, Type: "TXT", Value: "\"heritage=external-dns\""},
+			},
+			expected: []unboundlib.RR{
+				{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.2"},
+				{Name: "test.lan.", TTL: 300, Type: "TXT", Value: "\"heritage=external-dns\""},
+			},
+			changes: plan.Changes{
+				Delete: []*endpoint.Endpoint{
+					endpoint.NewEndpointWithTTL("test.lan", "A", endpoint.TTL(300), "192.168.1.1"),
+				},
+			},
+		},
+		{
+			name: "record update one target",
+			records: []unboundlib.RR{
+				{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+				{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.2"},
+				{Name: "test.lan.", TTL: 300, Type: "TXT", Value: "\"heritage=external-dns\""},
+			},
+			expected: []unboundlib.RR{
+				{Name: "test.lan.", TTL: 300, Type: "TXT", Value: "\"heritage=external-dns\""},
+				{Name: "test.lan", TTL: 300, Type: "A", Value: "192.168.1.1"},
+				{Name: "test.lan", TTL: 300, Type: "A", Value: "192.168.1.3"},
+			},
+			changes: plan.Changes{
+				UpdateOld: []*endpoint.Endpoint{
+					endpoint.NewEndpointWithTTL("test.lan.", "A", endpoint.TTL(300), "192.168.1.1", "192.168.1.2"),
+				},
+				UpdateNew: []*endpoint.Endpoint{
+					endpoint.NewEndpointWithTTL("test.lan.", "A", endpoint.TTL(300), "192.168.1.1", "192.168.1.3"),
+				},
+			},
+		},
+		{
+			name: "record create next to existing type",
+			records: []unboundlib.RR{
+				{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+			},
+			expected: []unboundlib.RR{
+				{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+				{Name: "test.lan", TTL: 300, Type: "TXT", Value: "\"heritage=external-dns\""},
+			},
+			changes: plan.Changes{
+				Create: []*endpoint.Endpoint{
+					endpoint.NewEndpointWithTTL("test.lan.", "TXT", endpoint.TTL(300), "\"heritage=external-dns\""),
+				},
+			},
+		},
+		{
+			name: "record update unchanged",
+			records: []unboundlib.RR{
+				{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+				{Name: "a.example.com.", TTL: 3600, Type: "CNAME", Value: "abc.def"},
+			},
+			expected: []unboundlib.RR{
+				{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+				{Name: "a.example.com.", TTL: 3600, Type: "CNAME", Value: "abc.def"},
+			},
+			changes: plan.Changes{
+				UpdateOld: []*endpoint.Endpoint{
+					endpoint.NewEndpointWithTTL("test.lan.", "A", endpoint.TTL(300), "192.168.1.1"),
+				},
+				UpdateNew: []*endpoint.Endpoint{
+					endpoint.NewEndpointWithTTL("test.lan.", "A", endpoint.TTL(300), "192.168.1.1"),
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			m := mockClient{records: tt.records}
 			p := &UnboundProvider{
-				client:     &m,
+				instances:  testInstances(&m),
 				defaultTTL: 7200,
 			}
 
@@ -320,8 +700,8 @@ func TestApplyChangesDryRun(t *testing.T) {
 
 	m := mockClient{records: expected}
 	p := &UnboundProvider{
-		client: &m,
-		dryRun: true,
+		instances: testInstances(&m),
+		dryRun:    true,
 	}
 
 	changes := plan.Changes{
@@ -359,3 +739,594 @@ func TestAdjustEndpoints(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, expected, result)
 }
+
+func TestApplyChangesRollback(t *testing.T) {
+	errAdd := errors.New("add failed")
+	errRemove := errors.New("remove failed")
+
+	tests := []struct {
+		name        string
+		records     []unboundlib.RR
+		expected    []unboundlib.RR
+		changes     plan.Changes
+		failOn      func(action string, rr unboundlib.RR) error
+		rolledBack  []string
+		notRestored []string
+	}{
+		{
+			name: "add fails",
+			records: []unboundlib.RR{
+				{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+				{Name: "test.lan.", TTL: 300, Type: "TXT", Value: "\"heritage=external-dns\""},
+				{Name: "a.example.com.", TTL: 3600, Type: "CNAME", Value: "abc.def"},
+			},
+			expected: []unboundlib.RR{
+				{Name: "a.example.com.", TTL: 3600, Type: "CNAME", Value: "abc.def"},
+				{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+				{Name: "test.lan.", TTL: 300, Type: "TXT", Value: "\"heritage=external-dns\""},
+			},
+			changes: plan.Changes{
+				UpdateOld: []*endpoint.Endpoint{
+					endpoint.NewEndpointWithTTL("test.lan", "A", endpoint.TTL(300), "192.168.1.1"),
+				},
+				UpdateNew: []*endpoint.Endpoint{
+					endpoint.NewEndpointWithTTL("test.lan", "A", endpoint.TTL(300), "192.168.1.2"),
+				},
+			},
+			failOn: func(action string, rr unboundlib.RR) error {
+				if action == actionCreate && rr.Value == "192.168.1.2" {
+					return errAdd
+				}
+				return nil
+			},
+			rolledBack: []string{"test.lan"},
+		},
+		{
+			name: "add fails after other names",
+			records: []unboundlib.RR{
+				{Name: "a.example.com.", TTL: 3600, Type: "CNAME", Value: "abc.def"},
+			},
+			expected: []unboundlib.RR{
+				{Name: "a.example.com.", TTL: 3600, Type: "CNAME", Value: "abc.def"},
+			},
+			changes: plan.Changes{
+				Create: []*endpoint.Endpoint{
+					endpoint.NewEndpointWithTTL("test.lan", "A", endpoint.TTL(300), "192.168.1.1"),
+					endpoint.NewEndpointWithTTL("b.test.lan", "A", endpoint.TTL(300), "192.168.1.2"),
+				},
+			},
+			failOn: func(action string, rr unboundlib.RR) error {
+				if action == actionCreate && rr.Value == "192.168.1.2" {
+					return errAdd
+				}
+				return nil
+			},
+			rolledBack: []string{"test.lan", "b.test.lan"},
+		},
+		{
+			name: "restore fails",
+			records: []unboundlib.RR{
+				{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+			},
+			expected: []unboundlib.RR{},
+			changes: plan.Changes{
+				UpdateOld: []*endpoint.Endpoint{
+					endpoint.NewEndpointWithTTL("test.lan", "A", endpoint.TTL(300), "192.168.1.1"),
+				},
+				UpdateNew: []*endpoint.Endpoint{
+					endpoint.NewEndpointWithTTL("test.lan", "A", endpoint.TTL(300), "192.168.1.2"),
+				},
+			},
+			failOn: func(action string, rr unboundlib.RR) error {
+				if action == actionCreate {
+					return errAdd
+				}
+				return nil
+			},
+			notRestored: []string{"test.lan"},
+		},
+		{
+			name: "remove fails",
+			records: []unboundlib.RR{
+				{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+			},
+			expected: []unboundlib.RR{
+				{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+			},
+			changes: plan.Changes{
+				Delete: []*endpoint.Endpoint{
+					endpoint.NewEndpointWithTTL("test.lan", "A", endpoint.TTL(300), "192.168.1.1"),
+				},
+			},
+			failOn: func(action string, rr unboundlib.RR) error {
+				if action == actionRemove {
+					return errRemove
+				}
+				return nil
+			},
+			notRestored: []string{"test.lan"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := mockClient{records: tt.records, failOn: tt.failOn}
+			p := &UnboundProvider{
+				instances: testInstances(&m),
+			}
+
+			err := p.ApplyChanges(context.TODO(), &tt.changes)
+			assert.Equal(t, tt.expected, m.records)
+
+			var txErr *TransactionError
+			if assert.ErrorAs(t, err, &txErr) {
+				assert.Equal(t, tt.rolledBack, txErr.RolledBack)
+				assert.Equal(t, tt.notRestored, txErr.NotRestored)
+			}
+		})
+	}
+}
+
+func TestApplyChangesDumpFails(t *testing.T) {
+	errDump := errors.New("list_local_data failed")
+	records := []unboundlib.RR{
+		{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+		{Name: "test.lan.", TTL: 300, Type: "TXT", Value: "\"heritage=external-dns\""},
+	}
+	m := &mockClient{records: records, dumpErr: errDump}
+	p := &UnboundProvider{
+		instances: testInstances(m),
+		desired: map[string][]unboundlib.RR{
+			"test.lan": records,
+		},
+	}
+
+	// The batch is aborted, nothing is changed without a snapshot to restore
+	err := p.ApplyChanges(context.TODO(), &plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("test.lan", "A", endpoint.TTL(300), "192.168.1.1"),
+		},
+		UpdateNew: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("test.lan", "A", endpoint.TTL(300), "192.168.1.2"),
+		},
+	})
+	assert.ErrorIs(t, err, errDump)
+	assert.Zero(t, m.commands)
+	assert.Equal(t, records, m.records)
+	assert.Equal(t, records, p.desired["test.lan"])
+
+	// Neither does the reconciliation
+	p.Reconcile(context.TODO())
+	assert.Zero(t, m.commands)
+	assert.Equal(t, records, m.records)
+}
+
+func TestGetDomainFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Configuration
+		expected string
+	}{
+		{
+			name:     "no filter",
+			config:   Configuration{},
+			expected: `{}`,
+		},
+		{
+			name: "domain filter",
+			config: Configuration{
+				DomainFilter:   []string{"example.com", "test.lan"},
+				ExcludeDomains: []string{"a.example.com"},
+			},
+			expected: `{"include":["example.com","test.lan"],"exclude":["a.example.com"]}`,
+		},
+		{
+			name: "regex filter",
+			config: Configuration{
+				RegexDomainFilter: ".*.lan",
+			},
+			expected: `{"regexInclude":".*.lan"}`,
+		},
+		{
+			name: "regex filter with exclusion",
+			config: Configuration{
+				RegexDomainFilter:    ".*.lan",
+				RegexDomainExclusion: "^a.*",
+			},
+			expected: `{"regexInclude":".*.lan","regexExclude":"^a.*"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &UnboundProvider{
+				domainFilter: testDomainFilter(t, tt.config),
+			}
+			webhook := api.WebhookServer{Provider: p}
+
+			rec := httptest.NewRecorder()
+			webhook.NegotiateHandler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, api.MediaTypeFormatAndVersion, rec.Header().Get(api.ContentTypeHeader))
+			assert.JSONEq(t, tt.expected, rec.Body.String())
+		})
+	}
+}
+
+func TestGetDomainFilterInvalidRegex(t *testing.T) {
+	_, err := GetDomainFilter(Configuration{RegexDomainFilter: "(.*.lan"})
+	assert.ErrorContains(t, err, "REGEXP_DOMAIN_FILTER: invalid regular expression")
+
+	_, err = GetDomainFilter(Configuration{RegexDomainFilter: ".*.lan", RegexDomainExclusion: "[a"})
+	assert.ErrorContains(t, err, "REGEXP_DOMAIN_FILTER_EXCLUSION: invalid regular expression")
+}
+
+func TestRecordsInstances(t *testing.T) {
+	first := &mockClient{records: []unboundlib.RR{
+		{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+		{Name: "a.example.com.", TTL: 3600, Type: "CNAME", Value: "abc.def"},
+	}}
+	second := &mockClient{records: []unboundlib.RR{
+		{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+		{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.2"},
+	}}
+	p := &UnboundProvider{
+		instances: testInstances(first, second),
+	}
+
+	result, err := p.Records(context.TODO())
+	assert.Nil(t, err)
+	assert.Equal(t, []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("test.lan.", "A", endpoint.TTL(300), "192.168.1.1", "192.168.1.2"),
+		endpoint.NewEndpointWithTTL("a.example.com.", "CNAME", endpoint.TTL(3600), "abc.def"),
+	}, result)
+}
+
+func TestRecordsInstancesTTL(t *testing.T) {
+	first := &mockClient{records: []unboundlib.RR{
+		{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+	}}
+	second := &mockClient{records: []unboundlib.RR{
+		{Name: "test.lan.", TTL: 60, Type: "A", Value: "192.168.1.1"},
+	}}
+	p := &UnboundProvider{
+		instances: testInstances(first, second),
+	}
+
+	result, err := p.Records(context.TODO())
+	assert.Nil(t, err)
+	assert.Equal(t, []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("test.lan.", "A", endpoint.TTL(60), "192.168.1.1"),
+	}, result)
+}
+
+func TestRecordsInstancesFail(t *testing.T) {
+	errDump := errors.New("list_local_data failed")
+	records := []unboundlib.RR{
+		{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+	}
+
+	tests := []struct {
+		name          string
+		failurePolicy string
+		failing       []bool
+		expected      []*endpoint.Endpoint
+	}{
+		{
+			name:          "fail with a failing instance",
+			failurePolicy: FailurePolicyFail,
+			failing:       []bool{false, true},
+		},
+		{
+			name:          "tolerate with a failing instance",
+			failurePolicy: FailurePolicyTolerate,
+			failing:       []bool{false, true},
+			expected: []*endpoint.Endpoint{
+				endpoint.NewEndpointWithTTL("test.lan.", "A", endpoint.TTL(300), "192.168.1.1"),
+			},
+		},
+		{
+			name:          "tolerate with every instance failing",
+			failurePolicy: FailurePolicyTolerate,
+			failing:       []bool{true, true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clients := []Client{}
+			for _, failing := range tt.failing {
+				m := &mockClient{records: records}
+				if failing {
+					m.dumpErr = errDump
+				}
+				clients = append(clients, m)
+			}
+			p := &UnboundProvider{
+				instances:     testInstances(clients...),
+				failurePolicy: tt.failurePolicy,
+			}
+
+			result, err := p.Records(context.TODO())
+			if tt.expected == nil {
+				assert.ErrorIs(t, err, errDump)
+				assert.Nil(t, result)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestApplyChangesInstances(t *testing.T) {
+	errAdd := errors.New("add failed")
+	failAdd := func(action string, rr unboundlib.RR) error {
+		if action == actionCreate {
+			return errAdd
+		}
+		return nil
+	}
+	changes := plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("test.lan", "A", endpoint.TTL(300), "192.168.1.1"),
+		},
+	}
+
+	t.Run("all succeed", func(t *testing.T) {
+		first, second := &mockClient{}, &mockClient{}
+		p := &UnboundProvider{
+			instances: testInstances(first, second),
+		}
+
+		err := p.ApplyChanges(context.TODO(), &changes)
+		assert.Nil(t, err)
+		assert.Equal(t, []unboundlib.RR{{Name: "test.lan", TTL: 300, Type: "A", Value: "192.168.1.1"}}, first.records)
+		assert.Equal(t, []unboundlib.RR{{Name: "test.lan", TTL: 300, Type: "A", Value: "192.168.1.1"}}, second.records)
+	})
+
+	t.Run("fail policy", func(t *testing.T) {
+		first, second := &mockClient{}, &mockClient{failOn: failAdd}
+		p := &UnboundProvider{
+			instances:     testInstances(first, second),
+			failurePolicy: FailurePolicyFail,
+		}
+
+		err := p.ApplyChanges(context.TODO(), &changes)
+		assert.ErrorIs(t, err, errAdd)
+		assert.Empty(t, first.records)
+		assert.Empty(t, second.records)
+		assert.Empty(t, p.instances[1].pending)
+	})
+
+	t.Run("tolerate policy", func(t *testing.T) {
+		first, second := &mockClient{}, &mockClient{failOn: failAdd}
+		p := &UnboundProvider{
+			instances:     testInstances(first, second),
+			failurePolicy: FailurePolicyTolerate,
+		}
+
+		err := p.ApplyChanges(context.TODO(), &changes)
+		assert.Nil(t, err)
+		assert.Equal(t, []unboundlib.RR{{Name: "test.lan", TTL: 300, Type: "A", Value: "192.168.1.1"}}, first.records)
+		assert.Empty(t, second.records)
+		assert.Len(t, p.instances[1].pending, 1)
+
+		// The pending changes are retried once the instance is back
+		second.failOn = nil
+		_, err = p.Records(context.TODO())
+		assert.Nil(t, err)
+		assert.Equal(t, []unboundlib.RR{{Name: "test.lan", TTL: 300, Type: "A", Value: "192.168.1.1"}}, second.records)
+		assert.Empty(t, p.instances[1].pending)
+	})
+
+	t.Run("tolerate policy all failing", func(t *testing.T) {
+		first, second := &mockClient{failOn: failAdd}, &mockClient{failOn: failAdd}
+		p := &UnboundProvider{
+			instances:     testInstances(first, second),
+			failurePolicy: FailurePolicyTolerate,
+		}
+
+		err := p.ApplyChanges(context.TODO(), &changes)
+		assert.ErrorIs(t, err, errAdd)
+		assert.Empty(t, p.instances[0].pending)
+		assert.Empty(t, p.instances[1].pending)
+	})
+}
+
+func TestCheck(t *testing.T) {
+	errStatus := errors.New("connection refused")
+
+	p := &UnboundProvider{
+		instances: testInstances(&mockClient{}, &mockClient{}),
+	}
+	assert.Nil(t, p.Check())
+
+	p = &UnboundProvider{
+		instances: testInstances(&mockClient{}, &mockClient{statusErr: errStatus}),
+	}
+	assert.ErrorIs(t, p.Check(), errStatus)
+	assert.ErrorContains(t, p.Check(), "unbound instance unbound-1 is not reachable")
+
+	p.failurePolicy = FailurePolicyTolerate
+	assert.Nil(t, p.Check())
+
+	p = &UnboundProvider{
+		instances:     testInstances(&mockClient{statusErr: errStatus}, &mockClient{statusErr: errStatus}),
+		failurePolicy: FailurePolicyTolerate,
+	}
+	assert.ErrorIs(t, p.Check(), errStatus)
+}
+
+func TestCheckInstances(t *testing.T) {
+	errStatus := errors.New("connection refused")
+	p := &UnboundProvider{
+		instances: testInstances(&mockClient{}, &mockClient{statusErr: errStatus}),
+	}
+
+	assert.Equal(t, []InstanceStatus{
+		{Host: "unbound-0"},
+		{Host: "unbound-1", Err: errStatus},
+	}, p.CheckInstances())
+}
+
+func TestPlanChanges(t *testing.T) {
+	p := &UnboundProvider{defaultTTL: 300, ptrRecords: true}
+	changes := p.PlanChanges(&plan.Changes{
+		Create:    []*endpoint.Endpoint{endpoint.NewEndpoint("a.test.lan", "A", "192.168.1.1")},
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("b.test.lan", "CNAME", 60, "a.test.lan")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("b.test.lan", "CNAME", 60, "c.test.lan")},
+		Delete: []*endpoint.Endpoint{
+			endpoint.NewEndpoint("d.test.lan", "TXT", `"text"`).WithProviderSpecific(PropertyView, "office"),
+		},
+	})
+
+	lines := []string{}
+	for _, change := range changes {
+		lines = append(lines, change.String())
+	}
+	assert.Equal(t, []string{
+		"CREATE\ta.test.lan\t300\tIN\tA\t192.168.1.1",
+		"REMOVE\tb.test.lan\t60\tIN\tCNAME\ta.test.lan",
+		"CREATE\tb.test.lan\t60\tIN\tCNAME\tc.test.lan",
+		"REMOVE\td.test.lan\t300\tIN\tTXT\t\"text\"\t(view office)",
+		"CREATE\t1.1.168.192.in-addr.arpa.\t300\tIN\tPTR\ta.test.lan.",
+	}, lines)
+}
+
+func TestApplyChangesDeadline(t *testing.T) {
+	records := []unboundlib.RR{
+		{Name: "a.test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+	}
+	client := &slowClient{mockClient: &mockClient{records: append([]unboundlib.RR{}, records...)}, latency: 20 * time.Millisecond}
+	p := &UnboundProvider{
+		instances:      []*instance{{host: "unbound-0", client: client}},
+		requestTimeout: 50 * time.Millisecond,
+	}
+
+	create := []*endpoint.Endpoint{}
+	for i := range 10 {
+		create = append(create, endpoint.NewEndpointWithTTL(fmt.Sprintf("host-%d.test.lan", i), "A", endpoint.TTL(300), "192.168.1.2"))
+	}
+
+	start := time.Now()
+	err := p.ApplyChanges(context.TODO(), &plan.Changes{Create: create})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 200*time.Millisecond)
+
+	// The names created before the deadline are rolled back
+	var txErr *TransactionError
+	assert.ErrorAs(t, err, &txErr)
+	assert.NotEmpty(t, txErr.RolledBack)
+	assert.Empty(t, txErr.NotRestored)
+	assert.Equal(t, records, client.records)
+	assert.Nil(t, p.desired)
+}
+
+func TestApplyChangesCanceled(t *testing.T) {
+	records := []unboundlib.RR{
+		{Name: "a.test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+		{Name: "b.test.lan.", TTL: 300, Type: "A", Value: "192.168.1.2"},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The request is abandoned while a.test.lan is being updated, between the
+	// removal of its records and their addition
+	m := &mockClient{
+		records: append([]unboundlib.RR{}, records...),
+		failOn: func(action string, rr unboundlib.RR) error {
+			if action == actionRemove && canonicalName(rr.Name) == "a.test.lan" {
+				cancel()
+			}
+			return nil
+		},
+	}
+	other := &mockClient{records: append([]unboundlib.RR{}, records...)}
+	p := &UnboundProvider{instances: testInstances(m, other)}
+
+	err := p.ApplyChanges(ctx, &plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("a.test.lan", "A", endpoint.TTL(300), "192.168.1.1"),
+			endpoint.NewEndpointWithTTL("b.test.lan", "A", endpoint.TTL(300), "192.168.1.2"),
+		},
+		UpdateNew: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("a.test.lan", "A", endpoint.TTL(300), "192.168.1.10"),
+			endpoint.NewEndpointWithTTL("b.test.lan", "A", endpoint.TTL(300), "192.168.1.20"),
+		},
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	var txErr *TransactionError
+	assert.ErrorAs(t, err, &txErr)
+	assert.Equal(t, []string{"a.test.lan"}, txErr.RolledBack)
+	assert.ElementsMatch(t, records, m.records)
+	// The removal of a.test.lan and its restoration, b.test.lan and the other
+	// instance are not touched
+	assert.Equal(t, 3, m.commands)
+	assert.Zero(t, other.commands)
+}
+
+func TestRecordsCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	m := &mockClient{
+		records: []unboundlib.RR{
+			{Name: "a.test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+		},
+	}
+	p := &UnboundProvider{instances: testInstances(m)}
+
+	endpoints, err := p.Records(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, endpoints)
+	assert.Nil(t, p.desired)
+	assert.Zero(t, m.dumps)
+}
+
+func TestApplyChangesCanceledDuringCommand(t *testing.T) {
+	records := []unboundlib.RR{
+		{Name: "a.test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+		{Name: "b.test.lan.", TTL: 300, Type: "A", Value: "192.168.1.2"},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The request is abandoned while the removal of a.test.lan is still
+	// running on the control channel, which completes it afterwards
+	m := &mockClient{
+		records: append([]unboundlib.RR{}, records...),
+		failOn: func(action string, rr unboundlib.RR) error {
+			if action == actionRemove && canonicalName(rr.Name) == "a.test.lan" && ctx.Err() == nil {
+				cancel()
+				time.Sleep(50 * time.Millisecond)
+			}
+			return nil
+		},
+	}
+	p := &UnboundProvider{instances: testInstances(m)}
+
+	err := p.ApplyChanges(ctx, &plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("a.test.lan", "A", endpoint.TTL(300), "192.168.1.1"),
+			endpoint.NewEndpointWithTTL("b.test.lan", "A", endpoint.TTL(300), "192.168.1.2"),
+		},
+		UpdateNew: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("a.test.lan", "A", endpoint.TTL(300), "192.168.1.10"),
+			endpoint.NewEndpointWithTTL("b.test.lan", "A", endpoint.TTL(300), "192.168.1.20"),
+		},
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// The rollback waited for the removal before restoring a.test.lan, so the
+	// final records are the original ones
+	var txErr *TransactionError
+	assert.ErrorAs(t, err, &txErr)
+	assert.Equal(t, []string{"a.test.lan"}, txErr.RolledBack)
+	assert.Empty(t, txErr.NotRestored)
+	assert.ElementsMatch(t, records, m.records)
+	assert.Equal(t, 3, m.commands)
+	assert.Nil(t, p.desired)
+}
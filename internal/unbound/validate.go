@@ -0,0 +1,262 @@
+package unbound
+
+import (
+	"errors"
+	"fmt"
+	unboundlib "github.com/guillomep/go-unbound"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// ValidationError is returned for an invalid configuration, with the errors of
+// all its invalid settings.
+type ValidationError struct {
+	Errors []*SettingError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Unwrap returns the errors of the settings.
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// add records an error, the joined errors are recorded one by one. The errors
+// that are not errors of a setting are recorded without setting.
+func (e *ValidationError) add(err error) {
+	var settingErr *SettingError
+	switch joined := err.(type) {
+	case nil:
+	case interface{ Unwrap() []error }:
+		for _, err := range joined.Unwrap() {
+			e.add(err)
+		}
+	default:
+		if !errors.As(err, &settingErr) {
+			settingErr = &SettingError{Err: err}
+		}
+		e.Errors = append(e.Errors, settingErr)
+	}
+}
+
+// SettingError is the error of an invalid setting, named after its environment
+// variable.
+type SettingError struct {
+	Setting string
+	Err     error
+}
+
+func (e *SettingError) Error() string {
+	if e.Setting == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s: %v", e.Setting, e.Err)
+}
+
+func (e *SettingError) Unwrap() error {
+	return e.Err
+}
+
+// invalidSetting returns the error of an invalid setting.
+func invalidSetting(setting, format string, a ...any) *SettingError {
+	return &SettingError{Setting: setting, Err: fmt.Errorf(format, a...)}
+}
+
+// Validate checks the configuration. It returns a *ValidationError reporting
+// all the invalid settings at once.
+func (c *Configuration) Validate() error {
+	errs := &ValidationError{}
+	if len(c.Host) == 0 {
+		errs.add(invalidSetting("UNBOUND_HOST", "at least one Unbound host is required"))
+	}
+	for _, host := range c.Host {
+		if path, ok := socketPath(host); ok {
+			if err := validateSocket(path); err != nil {
+				errs.add(invalidSetting("UNBOUND_HOST", "invalid Unbound host %s: %w", host, err))
+			}
+		}
+	}
+
+	switch c.FailurePolicy {
+	case "", FailurePolicyFail, FailurePolicyTolerate:
+	default:
+		errs.add(invalidSetting("UNBOUND_FAILURE_POLICY", "unknown failure policy %q", c.FailurePolicy))
+	}
+
+	errs.add(validateLocalZone(c))
+	errs.add(validateCacheFlush(c))
+	errs.add(validateRetry(c))
+
+	if c.BulkSize < 0 {
+		errs.add(invalidSetting("UNBOUND_BULK_SIZE", "bulk size must not be negative, got %d", c.BulkSize))
+	}
+	if c.TLSReloadInterval < 0 {
+		errs.add(invalidSetting("UNBOUND_TLS_RELOAD_INTERVAL", "TLS reload interval must not be negative, got %d", c.TLSReloadInterval))
+	}
+	if c.RequestTimeout < 0 {
+		errs.add(invalidSetting("UNBOUND_REQUEST_TIMEOUT", "request timeout must not be negative, got %d", c.RequestTimeout))
+	}
+	if c.SnapshotInterval < 0 {
+		errs.add(invalidSetting("UNBOUND_SNAPSHOT_INTERVAL", "snapshot interval must not be negative, got %d", c.SnapshotInterval))
+	}
+	if c.DefaultTTL <= 0 {
+		errs.add(invalidSetting("DEFAULT_TTL", "default TTL must be positive, got %d", c.DefaultTTL))
+	}
+
+	if len(c.Views) > 0 {
+		if _, err := parseViews(strings.Join(c.Views, ",")); err != nil {
+			errs.add(&SettingError{Setting: "UNBOUND_VIEWS", Err: err})
+		}
+	}
+
+	errs.add(validateDomainFilter(c))
+	errs.add(validateCertificateFiles(c))
+
+	if len(errs.Errors) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validateDomainFilter checks that the domains of the domain filter are DNS
+// names, and that its regular expressions compile.
+func validateDomainFilter(config *Configuration) error {
+	var errs []error
+	for _, filter := range []struct {
+		setting string
+		domains []string
+	}{
+		{setting: "DOMAIN_FILTER", domains: config.DomainFilter},
+		{setting: "EXCLUDE_DOMAIN_FILTER", domains: config.ExcludeDomains},
+	} {
+		for _, domain := range filter.domains {
+			if err := validateDomain(strings.TrimSpace(domain)); err != nil {
+				errs = append(errs, &SettingError{Setting: filter.setting, Err: err})
+			}
+		}
+	}
+
+	for _, filter := range []struct {
+		setting string
+		regex   string
+	}{
+		{setting: "REGEXP_DOMAIN_FILTER", regex: config.RegexDomainFilter},
+		{setting: "REGEXP_DOMAIN_FILTER_EXCLUSION", regex: config.RegexDomainExclusion},
+	} {
+		if _, err := regexp.Compile(filter.regex); err != nil {
+			errs = append(errs, invalidSetting(filter.setting, "invalid regular expression: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateDomain checks that a domain of the domain filter is a DNS name. The
+// leading dot of the filters matching only the subdomains is allowed, and the
+// empty domains are ignored like ExternalDNS does.
+func validateDomain(domain string) error {
+	if domain == "" {
+		return nil
+	}
+
+	name := strings.TrimSuffix(strings.TrimPrefix(domain, "."), ".")
+	if name == "" || len(name) > 253 {
+		return fmt.Errorf("invalid domain %q", domain)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") ||
+			strings.ContainsFunc(label, func(r rune) bool {
+				return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_'
+			}) {
+			return fmt.Errorf("invalid domain %q", domain)
+		}
+	}
+	return nil
+}
+
+// validateCertificateFiles checks that the TLS files of the instances exist and
+// parse, and that the control certificates match their private keys. The files
+// of the control sockets are not used, and not checked.
+func validateCertificateFiles(config *Configuration) error {
+	errs := validateInstancePaths(config)
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	checked := map[string]bool{}
+	for i, host := range config.Host {
+		if _, ok := socketPath(host); ok {
+			continue
+		}
+
+		files, err := config.certificateFiles(i)
+		if err != nil {
+			return err
+		}
+
+		valid := true
+		for _, file := range []struct {
+			setting string
+			path    string
+			option  func(string) unboundlib.OptionFn
+		}{
+			{setting: "UNBOUND_CA_PEM_PATH", path: files.ca, option: unboundlib.WithServerCertificatesFile},
+			{setting: "UNBOUND_KEY_PEM_PATH", path: files.key, option: unboundlib.WithControlPrivateKeyFile},
+			{setting: "UNBOUND_CERT_PEM_PATH", path: files.cert, option: unboundlib.WithControlCertificatesFile},
+		} {
+			// The files shared by the instances are reported once
+			key := file.setting + "\x00" + file.path
+			if _, err := loadOptions(file.option(file.path)); err != nil {
+				valid = false
+				if !checked[key] {
+					errs = append(errs, &SettingError{Setting: file.setting, Err: err})
+				}
+			}
+			checked[key] = true
+		}
+		if !valid {
+			continue
+		}
+
+		options, _ := loadOptions(files.options()...)
+		if err := validateCertificates(options); err != nil && !checked[files.key+"\x00"+files.cert] {
+			errs = append(errs, &SettingError{Setting: "UNBOUND_CERT_PEM_PATH", Err: fmt.Errorf("%s: %w", files.cert, err)})
+		}
+		checked[files.key+"\x00"+files.cert] = true
+	}
+	return errors.Join(errs...)
+}
+
+// validateInstancePaths checks that there is a single path, or a path per
+// instance, in the settings of the TLS files.
+func validateInstancePaths(config *Configuration) []error {
+	if len(config.Host) == 0 {
+		return nil
+	}
+
+	var errs []error
+	for _, paths := range []struct {
+		setting string
+		name    string
+		paths   []string
+	}{
+		{setting: "UNBOUND_CA_PEM_PATH", name: "CA certificates", paths: config.CaPemPath},
+		{setting: "UNBOUND_KEY_PEM_PATH", name: "private keys", paths: config.KeyPemPath},
+		{setting: "UNBOUND_CERT_PEM_PATH", name: "certificates", paths: config.CertPemPath},
+	} {
+		if _, err := instancePath(paths.paths, 0, len(config.Host)); err != nil {
+			errs = append(errs, invalidSetting(paths.setting, "invalid %s: %w", paths.name, err))
+		}
+	}
+	return errs
+}
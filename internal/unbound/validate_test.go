@@ -0,0 +1,175 @@
+package unbound
+
+import (
+	"errors"
+	"github.com/guillomep/external-dns-unbound-webhook/internal/testca"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+// settings returns the names of the invalid settings of a validation error.
+func settings(t *testing.T, err error) []string {
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	names := []string{}
+	for _, settingErr := range validationErr.Errors {
+		names = append(names, settingErr.Setting)
+	}
+	return names
+}
+
+func TestConfigurationValidate(t *testing.T) {
+	config := &Configuration{
+		Host:                 []string{"unbound-1", "unbound-2"},
+		CertPemPath:          []string{"cert.pem", "cert.pem", "cert.pem"},
+		FailurePolicy:        "unknown",
+		LocalZoneType:        "unknown",
+		LocalZoneScope:       "unknown",
+		BulkSize:             -1,
+		RetryBackoff:         -1,
+		RetryMaxBackoff:      -1,
+		Views:                []string{"home office"},
+		DomainFilter:         []string{"example.com", "exa mple.com"},
+		RegexDomainFilter:    "(example",
+		RegexDomainExclusion: "[",
+	}
+
+	// All the invalid settings are reported
+	err := config.Validate()
+	assert.Equal(t, []string{
+		"UNBOUND_FAILURE_POLICY",
+		"UNBOUND_LOCAL_ZONE_TYPE",
+		"UNBOUND_LOCAL_ZONE_SCOPE",
+		"UNBOUND_RETRY_BACKOFF",
+		"UNBOUND_RETRY_MAX_BACKOFF",
+		"UNBOUND_BULK_SIZE",
+		"DEFAULT_TTL",
+		"UNBOUND_VIEWS",
+		"DOMAIN_FILTER",
+		"REGEXP_DOMAIN_FILTER",
+		"REGEXP_DOMAIN_FILTER_EXCLUSION",
+		"UNBOUND_CERT_PEM_PATH",
+	}, settings(t, err))
+	assert.ErrorContains(t, err, `UNBOUND_FAILURE_POLICY: unknown failure policy "unknown"`)
+	assert.ErrorContains(t, err, "UNBOUND_BULK_SIZE: bulk size must not be negative, got -1")
+	assert.ErrorContains(t, err, "DEFAULT_TTL: default TTL must be positive, got 0")
+	assert.ErrorContains(t, err, `UNBOUND_VIEWS: invalid view name "home office"`)
+	assert.ErrorContains(t, err, `DOMAIN_FILTER: invalid domain "exa mple.com"`)
+	assert.ErrorContains(t, err, "REGEXP_DOMAIN_FILTER: invalid regular expression: error parsing regexp: missing closing )")
+	assert.ErrorContains(t, err, "UNBOUND_CERT_PEM_PATH: invalid certificates: expected 1 or 2 paths, got 3")
+
+	// The paths are not checked without host
+	err = (&Configuration{CertPemPath: []string{"cert.pem", "cert.pem"}, DefaultTTL: 300}).Validate()
+	assert.EqualError(t, err, "UNBOUND_HOST: at least one Unbound host is required")
+
+	// NewProvider returns the validation error
+	_, err = NewProvider(config)
+	assert.Len(t, settings(t, err), 12)
+
+	assert.Nil(t, (&Configuration{Host: []string{"unbound"}, DefaultTTL: 300}).Validate())
+}
+
+func TestValidateDomain(t *testing.T) {
+	tests := []struct {
+		domain string
+		valid  bool
+	}{
+		{domain: "example.com", valid: true},
+		{domain: "example.com.", valid: true},
+		{domain: ".example.com", valid: true},
+		{domain: "sub-domain.example.com", valid: true},
+		{domain: "_srv.example.com", valid: true},
+		{domain: "bücher.de", valid: true},
+		{domain: "lan", valid: true},
+		{domain: "", valid: true},
+		{domain: ".", valid: false},
+		{domain: "example..com", valid: false},
+		{domain: "-example.com", valid: false},
+		{domain: "example-.com", valid: false},
+		{domain: "exa mple.com", valid: false},
+		{domain: "*.example.com", valid: false},
+		{domain: "example.com/24", valid: false},
+		{domain: "a123456789012345678901234567890123456789012345678901234567890123.com", valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			err := validateDomain(tt.domain)
+			if tt.valid {
+				assert.Nil(t, err)
+			} else {
+				assert.EqualError(t, err, `invalid domain "`+tt.domain+`"`)
+			}
+		})
+	}
+}
+
+func TestValidateCertificateFiles(t *testing.T) {
+	ca := testca.NewRSA(t, "ca")
+	dir := t.TempDir()
+	caPath := filepath.Join(dir, "ca.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	certPath := filepath.Join(dir, "cert.pem")
+	otherCertPath := filepath.Join(dir, "other-cert.pem")
+	invalidPath := filepath.Join(dir, "invalid.pem")
+	certPEM, keyPEM := ca.Issue(t, "webhook")
+	otherCertPEM, _ := ca.Issue(t, "webhook")
+	testca.WriteFile(t, caPath, ca.PEM())
+	testca.WriteFile(t, keyPath, keyPEM)
+	testca.WriteFile(t, certPath, certPEM)
+	testca.WriteFile(t, otherCertPath, otherCertPEM)
+	testca.WriteFile(t, invalidPath, []byte("invalid"))
+
+	tests := []struct {
+		name     string
+		config   Configuration
+		expected []string
+	}{
+		{
+			name:   "valid files",
+			config: Configuration{Host: []string{"unbound-1", "unbound-2"}, CaPemPath: []string{caPath}, KeyPemPath: []string{keyPath}, CertPemPath: []string{certPath}},
+		},
+		{
+			name:   "no files",
+			config: Configuration{Host: []string{"unbound"}},
+		},
+		{
+			name:     "missing files",
+			config:   Configuration{Host: []string{"unbound-1", "unbound-2"}, CaPemPath: []string{filepath.Join(dir, "missing.pem")}, KeyPemPath: []string{keyPath}, CertPemPath: []string{certPath}},
+			expected: []string{"UNBOUND_CA_PEM_PATH: could not read server certificate file"},
+		},
+		{
+			name:   "invalid files",
+			config: Configuration{Host: []string{"unbound"}, CaPemPath: []string{invalidPath}, KeyPemPath: []string{invalidPath}, CertPemPath: []string{invalidPath}},
+			expected: []string{
+				"UNBOUND_CA_PEM_PATH: invalid certificate file " + invalidPath,
+				"UNBOUND_KEY_PEM_PATH: invalid private key file " + invalidPath,
+				"UNBOUND_CERT_PEM_PATH: invalid certificate file " + invalidPath,
+			},
+		},
+		{
+			name:     "certificate not matching the private key",
+			config:   Configuration{Host: []string{"unbound-1", "unbound-2"}, KeyPemPath: []string{keyPath}, CertPemPath: []string{certPath, otherCertPath}},
+			expected: []string{"UNBOUND_CERT_PEM_PATH: " + otherCertPath + ": the control certificate does not match the control private key"},
+		},
+		{
+			name:     "wrong number of files",
+			config:   Configuration{Host: []string{"unbound-1", "unbound-2", "unbound-3"}, KeyPemPath: []string{keyPath, keyPath}},
+			expected: []string{"UNBOUND_KEY_PEM_PATH: invalid private keys: expected 1 or 3 paths, got 2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := &ValidationError{}
+			errs.add(validateCertificateFiles(&tt.config))
+			assert.Len(t, errs.Errors, len(tt.expected))
+			for i, expected := range tt.expected {
+				assert.ErrorContains(t, errs.Errors[i], expected)
+			}
+		})
+	}
+}
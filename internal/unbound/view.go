@@ -0,0 +1,209 @@
+package unbound
+
+import (
+	"context"
+	"fmt"
+	unboundlib "github.com/guillomep/go-unbound"
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/endpoint"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// viewSeparator separates the name of a record from its view in the keys of
+// the records of the views. It is not a valid character in a DNS name, so the
+// records of a view never collide with the global local data.
+const viewSeparator = "@"
+
+// scopedName returns the key of the records of a name in a view, the
+// canonical name for the global local data.
+func scopedName(view, name string) string {
+	name = canonicalName(name)
+	if view == "" {
+		return name
+	}
+	return name + viewSeparator + view
+}
+
+// splitScopedName returns the view and the name of a key.
+func splitScopedName(key string) (string, string) {
+	name, view, _ := strings.Cut(key, viewSeparator)
+	return view, name
+}
+
+// groupByView groups the records of a view by key.
+func groupByView(view string, records []unboundlib.RR) map[string][]unboundlib.RR {
+	grouped := map[string][]unboundlib.RR{}
+	for _, rr := range records {
+		key := scopedName(view, rr.Name)
+		grouped[key] = append(grouped[key], rr)
+	}
+	return grouped
+}
+
+// parseViews returns the sorted and deduplicated list of views of a comma
+// separated list.
+func parseViews(value string) ([]string, error) {
+	views := []string{}
+	for _, view := range strings.Split(value, ",") {
+		view = strings.TrimSpace(view)
+		if err := validateView(view); err != nil {
+			return nil, err
+		}
+		if !slices.Contains(views, view) {
+			views = append(views, view)
+		}
+	}
+	sort.Strings(views)
+	return views, nil
+}
+
+// validateView checks that a view name can be sent on the control channel.
+func validateView(view string) error {
+	if view == "" || strings.ContainsAny(view, " \t"+viewSeparator+",") {
+		return fmt.Errorf("invalid view name %q", view)
+	}
+	return nil
+}
+
+// endpointViews returns the views the records of an endpoint go to: the views
+// of the endpoint, or the views of the provider. The empty view is the global
+// local data.
+func (p *UnboundProvider) endpointViews(ep *endpoint.Endpoint) []string {
+	if value, ok := ep.GetProviderSpecificProperty(PropertyView); ok {
+		return strings.Split(value, ",")
+	}
+	if len(p.views) > 0 {
+		return p.views
+	}
+	return []string{""}
+}
+
+// recordViews returns the views Records reads: the views of the provider and
+// the views of the desired state.
+func (p *UnboundProvider) recordViews() []string {
+	views := slices.Clone(p.views)
+	for key := range p.desired {
+		if view, _ := splitScopedName(key); view != "" && !slices.Contains(views, view) {
+			views = append(views, view)
+		}
+	}
+	sort.Strings(views)
+	return views
+}
+
+// localData returns the records of the instance in a view, the global local
+// data for the empty view.
+func (i *instance) localData(ctx context.Context, view string) ([]unboundlib.RR, error) {
+	if view == "" {
+		return i.control(ctx).ListLocalData()
+	}
+	return i.control(ctx).ViewLocalData(view)
+}
+
+// snapshot returns the records of the instance in the views, grouped by key.
+// The global local data is always part of the snapshot. It fails if a dump
+// fails, the names missing from an incomplete snapshot could not be restored.
+func (i *instance) snapshot(ctx context.Context, views []string) (map[string][]unboundlib.RR, error) {
+	client := i.control(ctx)
+	records, err := client.ListLocalData()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read local data: %w", err)
+	}
+	snapshot := groupByName(records)
+	for _, view := range views {
+		if view == "" {
+			continue
+		}
+
+		records, err := client.ViewLocalData(view)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read view %s: %w", view, err)
+		}
+		for key, rrs := range groupByView(view, records) {
+			snapshot[key] = rrs
+		}
+	}
+	return snapshot, nil
+}
+
+// addLocalData adds a record to a view, or to the global local data.
+func (i *instance) addLocalData(ctx context.Context, view string, rr unboundlib.RR) error {
+	if view == "" {
+		return i.control(ctx).AddLocalData(rr)
+	}
+	return i.control(ctx).AddViewLocalData(view, rr)
+}
+
+// removeLocalData removes the records of a name from a view, or from the
+// global local data.
+func (i *instance) removeLocalData(ctx context.Context, view string, rr unboundlib.RR) error {
+	if view == "" {
+		return i.control(ctx).RemoveLocalData(rr)
+	}
+	return i.control(ctx).RemoveViewLocalData(view, rr)
+}
+
+// viewEndpoints returns the endpoints of the records of the views. An RRset
+// holding the same records in several views is reported once. Unless they are
+// the views of the provider, its views are reported as its set identifier and
+// view property, which keeps it distinct from the global RRset of the same
+// name.
+func (p *UnboundProvider) viewEndpoints(ctx context.Context, divergent []int) ([]*endpoint.Endpoint, error) {
+	endpoints := []*endpoint.Endpoint{}
+	merged := map[string]*endpoint.Endpoint{}
+	views := map[*endpoint.Endpoint][]string{}
+
+	for _, view := range p.recordViews() {
+		records, err := p.localData(ctx, view, divergent)
+		if err != nil {
+			return nil, err
+		}
+		for _, ep := range p.endpoints(records) {
+			signature := rrsetSignature(ep)
+			if _, ok := merged[signature]; !ok {
+				merged[signature] = ep
+				endpoints = append(endpoints, ep)
+			}
+			views[merged[signature]] = append(views[merged[signature]], view)
+		}
+	}
+
+	defaultViews := strings.Join(p.views, ",")
+	for _, ep := range endpoints {
+		if epViews := strings.Join(views[ep], ","); epViews != defaultViews {
+			ep.SetIdentifier = epViews
+		}
+	}
+	return endpoints, nil
+}
+
+// rrsetSignature returns a string identifying the records of an endpoint.
+func rrsetSignature(ep *endpoint.Endpoint) string {
+	targets := slices.Clone(ep.Targets)
+	sort.Strings(targets)
+	return fmt.Sprintf("%s %s %d %s", canonicalName(ep.DNSName), ep.RecordType, ep.RecordTTL, strings.Join(targets, " "))
+}
+
+// adjustViews sets the set identifier of the endpoints of views other than
+// the views of the provider, as reported by Records.
+func (p *UnboundProvider) adjustViews(ep *endpoint.Endpoint) {
+	views, ok := ep.GetProviderSpecificProperty(PropertyView)
+	if !ok {
+		return
+	}
+
+	if views == strings.Join(p.views, ",") {
+		ep.DeleteProviderSpecificProperty(PropertyView)
+		return
+	}
+
+	if ep.SetIdentifier != "" && ep.SetIdentifier != views {
+		log.WithFields(log.Fields{
+			"record": ep.DNSName,
+			"type":   ep.RecordType,
+		}).Warnf("Replacing set identifier %q by the views %q.", ep.SetIdentifier, views)
+	}
+	ep.SetIdentifier = views
+}
@@ -0,0 +1,132 @@
+package unbound
+
+import (
+	"context"
+	unboundlib "github.com/guillomep/go-unbound"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+	"testing"
+)
+
+func TestParseViews(t *testing.T) {
+	views, err := parseViews(" vpn,office ,vpn")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"office", "vpn"}, views)
+
+	_, err = parseViews("office,")
+	assert.ErrorContains(t, err, `invalid view name ""`)
+
+	_, err = parseViews("office@home")
+	assert.ErrorContains(t, err, `invalid view name "office@home"`)
+
+	p, err := NewProvider(&Configuration{Host: []string{"testing"}, Views: []string{"vpn", "office"}, DefaultTTL: 300})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"office", "vpn"}, p.views)
+
+	_, err = NewProvider(&Configuration{Host: []string{"testing"}, Views: []string{"home office"}})
+	assert.ErrorContains(t, err, `invalid view name "home office"`)
+}
+
+func TestApplyChangesViews(t *testing.T) {
+	m := &mockClient{views: map[string][]unboundlib.RR{"office": {}, "vpn": {}}}
+	p := &UnboundProvider{
+		instances:    testInstances(m),
+		domainFilter: testDomainFilter(t, Configuration{}),
+	}
+
+	desired, err := p.AdjustEndpoints([]*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("a.test.lan", "A", endpoint.TTL(300), "192.168.1.1"),
+		endpoint.NewEndpointWithTTL("a.test.lan", "A", endpoint.TTL(300), "192.168.2.1").
+			WithProviderSpecific(PropertyView, "office"),
+		endpoint.NewEndpointWithTTL("b.test.lan", "A", endpoint.TTL(300), "192.168.2.2").
+			WithProviderSpecific(PropertyView, "vpn, office"),
+		endpoint.NewEndpointWithTTL("a.test.lan", "A", endpoint.TTL(300), "10.8.0.1").
+			WithProviderSpecific(PropertyView, "vpn"),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"", "office", "office,vpn", "vpn"}, []string{
+		desired[0].SetIdentifier, desired[1].SetIdentifier, desired[2].SetIdentifier, desired[3].SetIdentifier,
+	})
+
+	err = p.ApplyChanges(context.TODO(), &plan.Changes{Create: desired})
+	assert.Nil(t, err)
+	assert.Equal(t, []unboundlib.RR{
+		{Name: "a.test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+	}, m.records)
+	assert.Equal(t, map[string][]unboundlib.RR{
+		"office": {
+			{Name: "a.test.lan.", TTL: 300, Type: "A", Value: "192.168.2.1"},
+			{Name: "b.test.lan.", TTL: 300, Type: "A", Value: "192.168.2.2"},
+		},
+		"vpn": {
+			{Name: "b.test.lan.", TTL: 300, Type: "A", Value: "192.168.2.2"},
+			{Name: "a.test.lan.", TTL: 300, Type: "A", Value: "10.8.0.1"},
+		},
+	}, m.views)
+
+	endpoints, err := p.Records(context.TODO())
+	assert.Nil(t, err)
+	assert.Len(t, endpoints, 4)
+	for i, ep := range endpoints {
+		assert.Equal(t, canonicalName(desired[i].DNSName), ep.DNSName)
+		assert.Equal(t, desired[i].Targets, ep.Targets)
+		assert.Equal(t, desired[i].SetIdentifier, ep.SetIdentifier)
+		assert.Equal(t, desired[i].ProviderSpecific, ep.ProviderSpecific)
+	}
+
+	err = p.ApplyChanges(context.TODO(), &plan.Changes{Delete: desired[3:4]})
+	assert.Nil(t, err)
+	assert.Len(t, m.records, 1)
+	assert.Len(t, m.views["office"], 2)
+	assert.Equal(t, []unboundlib.RR{
+		{Name: "b.test.lan.", TTL: 300, Type: "A", Value: "192.168.2.2"},
+	}, m.views["vpn"])
+}
+
+func TestApplyChangesDefaultViews(t *testing.T) {
+	m := &mockClient{views: map[string][]unboundlib.RR{"office": {}}}
+	p := &UnboundProvider{
+		instances:    testInstances(m),
+		domainFilter: testDomainFilter(t, Configuration{}),
+		views:        []string{"office"},
+	}
+
+	desired, err := p.AdjustEndpoints([]*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("a.test.lan", "A", endpoint.TTL(300), "192.168.2.1"),
+		endpoint.NewEndpointWithTTL("b.test.lan", "A", endpoint.TTL(300), "192.168.2.2").
+			WithProviderSpecific(PropertyView, "office"),
+	})
+	assert.Nil(t, err)
+	assert.Empty(t, desired[1].SetIdentifier)
+	assert.Empty(t, desired[1].ProviderSpecific)
+
+	err = p.ApplyChanges(context.TODO(), &plan.Changes{Create: desired})
+	assert.Nil(t, err)
+	assert.Empty(t, m.records)
+	assert.Len(t, m.views["office"], 2)
+
+	endpoints, err := p.Records(context.TODO())
+	assert.Nil(t, err)
+	assert.Equal(t, []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("a.test.lan", "A", endpoint.TTL(300), "192.168.2.1"),
+		endpoint.NewEndpointWithTTL("b.test.lan", "A", endpoint.TTL(300), "192.168.2.2"),
+	}, endpoints)
+}
+
+func TestApplyChangesUnknownView(t *testing.T) {
+	m := &mockClient{}
+	p := &UnboundProvider{
+		instances:    testInstances(m),
+		domainFilter: testDomainFilter(t, Configuration{}),
+	}
+
+	err := p.ApplyChanges(context.TODO(), &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("a.test.lan", "A", endpoint.TTL(300), "192.168.2.1").
+				WithProviderSpecific(PropertyView, "office"),
+		},
+	})
+	assert.ErrorContains(t, err, "failed to read view office: view_list_local_data: no view with name: office")
+	assert.Empty(t, m.records)
+}
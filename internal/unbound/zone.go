@@ -0,0 +1,233 @@
+package unbound
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	// LocalZoneScopeDomain declares a local zone for each domain of the
+	// domain filter holding managed records.
+	LocalZoneScopeDomain = "domain"
+	// LocalZoneScopeEndpoint declares a local zone for each managed name.
+	LocalZoneScopeEndpoint = "endpoint"
+)
+
+// localZoneTypes are the types of local zones supported by Unbound.
+var localZoneTypes = []string{
+	"allow_notify", "always_deny", "always_nodata", "always_null", "always_nxdomain",
+	"always_refuse", "always_transparent", "block_a", "deny", "inform",
+	"inform_deny", "inform_redirect", "nodefault", "redirect", "refuse",
+	"static", "transparent", "typetransparent",
+}
+
+// LocalZone is a local zone of Unbound.
+type LocalZone struct {
+	Name string
+	Type string
+}
+
+// validateLocalZone checks the local zone type and scope of the configuration.
+func validateLocalZone(config *Configuration) error {
+	var errs []error
+	if config.LocalZoneType != "" && !slices.Contains(localZoneTypes, config.LocalZoneType) {
+		errs = append(errs, invalidSetting("UNBOUND_LOCAL_ZONE_TYPE", "unknown local zone type %q", config.LocalZoneType))
+	}
+
+	switch config.LocalZoneScope {
+	case "", LocalZoneScopeDomain, LocalZoneScopeEndpoint:
+	default:
+		errs = append(errs, invalidSetting("UNBOUND_LOCAL_ZONE_SCOPE", "unknown local zone scope %q", config.LocalZoneScope))
+	}
+	return errors.Join(errs...)
+}
+
+// filterDomain returns the longest domain of the domain filter the name
+// belongs to, or an empty string.
+func (p *UnboundProvider) filterDomain(name string) string {
+	name = canonicalName(name)
+
+	domain := ""
+	if p.domainFilter != nil {
+		for _, filter := range p.domainFilter.Filters {
+			filter = strings.TrimPrefix(canonicalName(filter), ".")
+			if (name == filter || strings.HasSuffix(name, "."+filter)) && len(filter) > len(domain) {
+				domain = filter
+			}
+		}
+	}
+	return domain
+}
+
+// zoneOf returns the local zone holding the record of a change. The local
+// zone type of the endpoint declares a zone for its name, otherwise the zone
+// depends on the scope of the provider. It returns false if the record does
+// not belong to a zone managed by the provider, like the records of views.
+func (p *UnboundProvider) zoneOf(change *UnboundChange) (LocalZone, bool) {
+	if change.View != "" {
+		return LocalZone{}, false
+	}
+	if change.LocalZoneType != "" {
+		return LocalZone{Name: canonicalName(change.RR.Name), Type: change.LocalZoneType}, true
+	}
+
+	name := p.defaultZone(change.RR.Name)
+	return LocalZone{Name: name, Type: p.localZoneType}, name != ""
+}
+
+// defaultZone returns the name of the local zone declared with the zone type
+// of the provider for a record name, or an empty string.
+func (p *UnboundProvider) defaultZone(name string) string {
+	if p.localZoneType == "" {
+		return ""
+	}
+	if p.localZoneScope == LocalZoneScopeEndpoint {
+		return canonicalName(name)
+	}
+	return p.filterDomain(name)
+}
+
+// createdZones returns the local zones of the records created by the changes.
+func (p *UnboundProvider) createdZones(changes []*UnboundChange) []LocalZone {
+	zones := []LocalZone{}
+	for _, change := range changes {
+		if change.Action != actionCreate {
+			continue
+		}
+		if zone, ok := p.zoneOf(change); ok && !slices.Contains(zones, zone) {
+			zones = append(zones, zone)
+		}
+	}
+	sort.Slice(zones, func(i, j int) bool { return zones[i].Name < zones[j].Name })
+	return zones
+}
+
+// holdsRecords returns true if the zone contains names of the desired state
+// holding records.
+func (p *UnboundProvider) holdsRecords(zone string) bool {
+	for name, records := range p.desired {
+		if len(records) > 0 && (name == zone || strings.HasSuffix(name, "."+zone)) {
+			return true
+		}
+	}
+	return false
+}
+
+// declareZones declares the local zones on the instance. They are declared
+// before the records they hold, otherwise Unbound creates a transparent zone
+// for each record. The zones that already exist on the instance and were not
+// declared by the provider, like the ones of unbound.conf, are left untouched
+// and never removed.
+func (p *UnboundProvider) declareZones(ctx context.Context, inst *instance, zones []LocalZone) error {
+	if len(zones) == 0 {
+		return nil
+	}
+
+	current, err := inst.control(ctx).LocalZones()
+	if err != nil {
+		return fmt.Errorf("failed to read local zones: %w", err)
+	}
+	existing := map[string]bool{}
+	for _, zone := range current {
+		existing[canonicalName(zone.Name)] = true
+	}
+
+	owned := []LocalZone{}
+	for _, zone := range zones {
+		if _, ok := p.zones[zone.Name]; existing[zone.Name] && !ok {
+			log.WithFields(log.Fields{
+				"instance": inst.host,
+				"zone":     zone.Name,
+			}).Debug("Keeping existing local zone.")
+			continue
+		}
+		owned = append(owned, zone)
+	}
+	return p.addZones(ctx, inst, owned)
+}
+
+// addZones declares local zones on the instance, they are then managed by the
+// provider.
+func (p *UnboundProvider) addZones(ctx context.Context, inst *instance, zones []LocalZone) error {
+	if p.zones == nil {
+		p.zones = map[string]string{}
+	}
+
+	client := inst.control(ctx)
+	for _, zone := range zones {
+		if err := client.AddLocalZone(zone.Name, zone.Type); err != nil {
+			return fmt.Errorf("failed to declare local zone %s: %w", zone.Name, err)
+		}
+		p.zones[zone.Name] = zone.Type
+	}
+	return nil
+}
+
+// cleanupZones removes the local zones declared by the provider that no
+// longer hold managed records. A zone that could not be removed from every
+// instance is retried on the next cleanup.
+func (p *UnboundProvider) cleanupZones(ctx context.Context) {
+	if p.desired == nil {
+		return
+	}
+
+	for zone := range p.zones {
+		if p.holdsRecords(zone) {
+			continue
+		}
+
+		removed := true
+		for _, inst := range p.instances {
+			if err := inst.control(ctx).RemoveLocalZone(zone); err != nil {
+				log.WithFields(log.Fields{
+					"instance": inst.host,
+					"zone":     zone,
+				}).Warnf("Could not remove local zone: %v", err)
+				removed = false
+			}
+		}
+		if removed {
+			log.WithField("zone", zone).Info("Removed local zone without managed records.")
+			delete(p.zones, zone)
+		}
+	}
+}
+
+// repairZones declares the local zones of the provider missing on the
+// instance.
+func (p *UnboundProvider) repairZones(ctx context.Context, inst *instance) error {
+	current, err := inst.control(ctx).LocalZones()
+	if err != nil {
+		return err
+	}
+
+	declared := map[LocalZone]bool{}
+	for _, zone := range current {
+		declared[LocalZone{Name: canonicalName(zone.Name), Type: zone.Type}] = true
+	}
+
+	missing := []LocalZone{}
+	names := []string{}
+	for name, zoneType := range p.zones {
+		if zone := (LocalZone{Name: name, Type: zoneType}); !declared[zone] {
+			missing = append(missing, zone)
+			names = append(names, name)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	sort.Slice(missing, func(i, j int) bool { return missing[i].Name < missing[j].Name })
+	sort.Strings(names)
+	log.WithFields(log.Fields{
+		"instance": inst.host,
+		"zones":    strings.Join(names, ","),
+	}).Warn("Repairing missing local zones.")
+	return p.addZones(ctx, inst, missing)
+}
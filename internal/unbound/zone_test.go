@@ -0,0 +1,222 @@
+package unbound
+
+import (
+	"context"
+	"errors"
+	"github.com/guillomep/external-dns-unbound-webhook/internal/unboundconf"
+	unboundlib "github.com/guillomep/go-unbound"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+	"testing"
+)
+
+func TestValidateLocalZone(t *testing.T) {
+	assert.Nil(t, validateLocalZone(&Configuration{}))
+	assert.Nil(t, validateLocalZone(&Configuration{LocalZoneType: "static", LocalZoneScope: LocalZoneScopeEndpoint}))
+	assert.ErrorContains(t, validateLocalZone(&Configuration{LocalZoneType: "unknown"}), `unknown local zone type "unknown"`)
+	assert.ErrorContains(t, validateLocalZone(&Configuration{LocalZoneScope: "unknown"}), `unknown local zone scope "unknown"`)
+}
+
+func TestApplyChangesLocalZones(t *testing.T) {
+	tests := []struct {
+		name      string
+		scope     string
+		created   map[string]string
+		remaining map[string]string
+	}{
+		{
+			name:    "domain",
+			scope:   LocalZoneScopeDomain,
+			created: map[string]string{"test.lan": "static"},
+			// b.test.lan still holds a record of the domain zone
+			remaining: map[string]string{"test.lan": "static"},
+		},
+		{
+			name:      "endpoint",
+			scope:     LocalZoneScopeEndpoint,
+			created:   map[string]string{"a.test.lan": "static", "b.test.lan": "static", "other.lan": "static"},
+			remaining: map[string]string{"b.test.lan": "static"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mockClient{}
+			p := &UnboundProvider{
+				instances:      testInstances(m),
+				domainFilter:   testDomainFilter(t, Configuration{DomainFilter: []string{"test.lan"}}),
+				localZoneType:  "static",
+				localZoneScope: tt.scope,
+			}
+
+			err := p.ApplyChanges(context.TODO(), &plan.Changes{
+				Create: []*endpoint.Endpoint{
+					endpoint.NewEndpointWithTTL("a.test.lan", "A", endpoint.TTL(300), "192.168.1.1"),
+					endpoint.NewEndpointWithTTL("b.test.lan", "A", endpoint.TTL(300), "192.168.1.2"),
+					endpoint.NewEndpointWithTTL("other.lan", "A", endpoint.TTL(300), "192.168.1.3"),
+				},
+			})
+			assert.Nil(t, err)
+			assert.Equal(t, tt.created, m.zones)
+
+			err = p.ApplyChanges(context.TODO(), &plan.Changes{
+				Delete: []*endpoint.Endpoint{
+					endpoint.NewEndpointWithTTL("a.test.lan", "A", endpoint.TTL(300), "192.168.1.1"),
+					endpoint.NewEndpointWithTTL("other.lan", "A", endpoint.TTL(300), "192.168.1.3"),
+				},
+			})
+			assert.Nil(t, err)
+			assert.Equal(t, tt.remaining, m.zones)
+
+			err = p.ApplyChanges(context.TODO(), &plan.Changes{
+				Delete: []*endpoint.Endpoint{
+					endpoint.NewEndpointWithTTL("b.test.lan", "A", endpoint.TTL(300), "192.168.1.2"),
+				},
+			})
+			assert.Nil(t, err)
+			assert.Empty(t, m.zones)
+			assert.Empty(t, p.zones)
+		})
+	}
+}
+
+func TestApplyChangesLocalZonesFailure(t *testing.T) {
+	m := &mockClient{failOn: func(action string, rr unboundlib.RR) error {
+		if action == actionCreate {
+			return errors.New("add failed")
+		}
+		return nil
+	}}
+	p := &UnboundProvider{
+		instances:      testInstances(m),
+		domainFilter:   testDomainFilter(t, Configuration{DomainFilter: []string{"test.lan"}}),
+		localZoneType:  "static",
+		localZoneScope: LocalZoneScopeDomain,
+		desired:        map[string][]unboundlib.RR{},
+	}
+
+	err := p.ApplyChanges(context.TODO(), &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("a.test.lan", "A", endpoint.TTL(300), "192.168.1.1"),
+		},
+	})
+	assert.ErrorContains(t, err, "add failed")
+	assert.Empty(t, m.records)
+	assert.Empty(t, m.zones)
+	assert.Empty(t, p.zones)
+}
+
+func TestApplyChangesExistingLocalZones(t *testing.T) {
+	// The zone of the operator, and the records of a name restored after a
+	// restart
+	m := &mockClient{
+		records: []unboundlib.RR{{Name: "a.test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"}},
+		zones:   map[string]string{"test.lan": "transparent"},
+	}
+	p := &UnboundProvider{
+		instances:      testInstances(m),
+		domainFilter:   testDomainFilter(t, Configuration{DomainFilter: []string{"test.lan"}}),
+		localZoneType:  "static",
+		localZoneScope: LocalZoneScopeDomain,
+	}
+
+	// The zone of the existing records is not claimed
+	_, err := p.Records(context.TODO())
+	assert.Nil(t, err)
+	assert.Empty(t, p.zones)
+
+	// Nor is its type overwritten
+	err = p.ApplyChanges(context.TODO(), &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("b.test.lan", "A", endpoint.TTL(300), "192.168.1.2"),
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"test.lan": "transparent"}, m.zones)
+
+	// Nor is it removed with the last managed record
+	err = p.ApplyChanges(context.TODO(), &plan.Changes{
+		Delete: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("a.test.lan", "A", endpoint.TTL(300), "192.168.1.1"),
+			endpoint.NewEndpointWithTTL("b.test.lan", "A", endpoint.TTL(300), "192.168.1.2"),
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"test.lan": "transparent"}, m.zones)
+	assert.Empty(t, p.zones)
+}
+
+func TestNewProviderPersistedZones(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "external-dns.conf")
+	zones := []unboundconf.Zone{{Name: "test.lan", Type: "static"}, {Name: "a.example.com", Type: "redirect"}}
+	if err := unboundconf.WriteFile(path, zones, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The zones of the include file were declared before the restart
+	config := &Configuration{
+		Host:           []string{"tcp://127.0.0.1:8953"},
+		DefaultTTL:     300,
+		DomainFilter:   []string{"test.lan", "example.com"},
+		LocalZoneType:  "static",
+		LocalZoneScope: LocalZoneScopeDomain,
+		PersistPath:    path,
+	}
+	p, err := NewProvider(config)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"test.lan": "static", "a.example.com": "redirect"}, p.zones)
+
+	// They are removed once they no longer hold managed records
+	m := &mockClient{
+		records: []unboundlib.RR{{Name: "a.test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"}},
+		zones:   map[string]string{"test.lan": "static", "a.example.com": "redirect"},
+	}
+	p.instances = testInstances(m)
+	_, err = p.Records(context.TODO())
+	assert.Nil(t, err)
+	err = p.ApplyChanges(context.TODO(), &plan.Changes{
+		Delete: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("a.test.lan", "A", endpoint.TTL(300), "192.168.1.1"),
+		},
+	})
+	assert.Nil(t, err)
+	assert.Empty(t, m.zones)
+	assert.Empty(t, p.zones)
+
+	// Without managed local zones, the transparent zones of the domain filter
+	// are not declared by the provider
+	if err := unboundconf.WriteFile(path, []unboundconf.Zone{{Name: "test.lan", Type: "transparent"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	config.LocalZoneType = ""
+	p, err = NewProvider(config)
+	assert.Nil(t, err)
+	assert.Empty(t, p.zones)
+}
+
+func TestReconcileLocalZones(t *testing.T) {
+	m := &mockClient{}
+	p := &UnboundProvider{
+		instances:      testInstances(m),
+		domainFilter:   testDomainFilter(t, Configuration{DomainFilter: []string{"test.lan"}}),
+		localZoneType:  "static",
+		localZoneScope: LocalZoneScopeDomain,
+	}
+
+	err := p.ApplyChanges(context.TODO(), &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("a.test.lan", "A", endpoint.TTL(300), "192.168.1.1"),
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"test.lan": "static"}, p.zones)
+
+	// Unbound restarted without the zone declared by the provider
+	m.zones = nil
+	m.records = nil
+	p.Reconcile(context.TODO())
+	assert.Equal(t, map[string]string{"test.lan": "static"}, m.zones)
+	assert.Equal(t, []unboundlib.RR{{Name: "a.test.lan", TTL: 300, Type: "A", Value: "192.168.1.1"}}, m.records)
+}
@@ -0,0 +1,177 @@
+// Package unboundconf renders records as an Unbound configuration snippet that
+// can be included from the Unbound configuration.
+package unboundconf
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	unboundlib "github.com/guillomep/go-unbound"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const header = "# Generated by external-dns-unbound-webhook, do not edit.\n"
+
+// Zone is a local zone declaration.
+type Zone struct {
+	Name string
+	Type string
+}
+
+// Render writes the zones and the records as the server clause of an Unbound
+// configuration snippet. Zones and records are sorted so the output only
+// changes with its content.
+func Render(w io.Writer, zones []Zone, records []unboundlib.RR) error {
+	zones = slices.Clone(zones)
+	slices.SortFunc(zones, func(a, b Zone) int {
+		return cmp.Compare(fqdn(a.Name), fqdn(b.Name))
+	})
+
+	var b strings.Builder
+	b.WriteString(header)
+	b.WriteString("server:\n")
+	for _, z := range zones {
+		fmt.Fprintf(&b, "  local-zone: %s %s\n", quote(fqdn(z.Name)), z.Type)
+	}
+	writeRecords(&b, records)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// RenderView writes the records of a view as sorted local-data lines. Unbound
+// refuses to start when a view is declared twice, so the snippet has no view
+// clause: it must be included from the clause of the view in the Unbound
+// configuration.
+func RenderView(w io.Writer, records []unboundlib.RR) error {
+	var b strings.Builder
+	b.WriteString(header)
+	writeRecords(&b, records)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeRecords writes the sorted records as local-data lines.
+func writeRecords(b *strings.Builder, records []unboundlib.RR) {
+	records = slices.Clone(records)
+	slices.SortFunc(records, func(a, b unboundlib.RR) int {
+		return cmp.Or(
+			cmp.Compare(fqdn(a.Name), fqdn(b.Name)),
+			cmp.Compare(a.Type, b.Type),
+			cmp.Compare(a.Value, b.Value),
+			cmp.Compare(a.TTL, b.TTL),
+		)
+	})
+
+	for _, rr := range records {
+		fmt.Fprintf(b, "  local-data: %s\n", quote(fmt.Sprintf("%s %d IN %s %s", fqdn(rr.Name), rr.TTL, rr.Type, rr.Value)))
+	}
+}
+
+// WriteFile renders the zones and the records into the file at path. The
+// file is written atomically: it is either left untouched or fully replaced.
+func WriteFile(path string, zones []Zone, records []unboundlib.RR) error {
+	var buf bytes.Buffer
+	if err := Render(&buf, zones, records); err != nil {
+		return err
+	}
+	return writeAtomic(path, buf.Bytes())
+}
+
+// WriteViewFile renders the records of a view into the file at path, as
+// atomically as WriteFile.
+func WriteViewFile(path string, records []unboundlib.RR) error {
+	var buf bytes.Buffer
+	if err := RenderView(&buf, records); err != nil {
+		return err
+	}
+	return writeAtomic(path, buf.Bytes())
+}
+
+// ReadZones returns the zones of the file at path written by WriteFile. A
+// missing file has no zones.
+func ReadZones(path string) ([]Zone, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	zones := []Zone{}
+	for _, line := range strings.Split(string(content), "\n") {
+		value, ok := strings.CutPrefix(strings.TrimSpace(line), "local-zone:")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid local zone %q", strings.TrimSpace(line))
+		}
+		zones = append(zones, Zone{Name: strings.Trim(fields[0], `"'`), Type: fields[1]})
+	}
+	return zones, nil
+}
+
+// ViewPath returns the path of the file of a view, next to the file at path:
+// the view office of external-dns.conf is in external-dns.office.conf.
+func ViewPath(path, view string) string {
+	ext := filepath.Ext(path)
+	view = strings.ReplaceAll(view, string(filepath.Separator), "_")
+	return strings.TrimSuffix(path, ext) + "." + view + ext
+}
+
+// writeAtomic replaces the file at path with the content, through a temporary
+// file renamed over it.
+func writeAtomic(path string, content []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("could not create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not write temporary file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not sync temporary file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("could not close temporary file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("could not set permissions on temporary file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("could not replace %s: %w", path, err)
+	}
+	return nil
+}
+
+// fqdn returns the name with a trailing dot.
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// quote quotes the value for the Unbound configuration, using single quotes
+// when the value itself contains double quotes, like TXT records.
+func quote(value string) string {
+	if strings.Contains(value, `"`) {
+		return "'" + value + "'"
+	}
+	return `"` + value + `"`
+}
@@ -0,0 +1,151 @@
+package unboundconf
+
+import (
+	"bytes"
+	"flag"
+	unboundlib "github.com/guillomep/go-unbound"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name    string
+		zones   []Zone
+		records []unboundlib.RR
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "records",
+			records: []unboundlib.RR{
+				{Name: "test.lan", TTL: 300, Type: "A", Value: "192.168.1.2"},
+				{Name: "a.example.com.", TTL: 3600, Type: "CNAME", Value: "abc.def."},
+				{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+				{Name: "test.lan.", TTL: 300, Type: "AAAA", Value: "fd00::1"},
+			},
+		},
+		{
+			name: "zones",
+			zones: []Zone{
+				{Name: "test.lan", Type: "static"},
+				{Name: "example.com.", Type: "transparent"},
+			},
+			records: []unboundlib.RR{
+				{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+			},
+		},
+		{
+			name: "txt",
+			records: []unboundlib.RR{
+				{Name: "test.lan.", TTL: 300, Type: "TXT", Value: "\"heritage=external-dns,external-dns/owner=default\""},
+				{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := Render(&buf, tt.zones, tt.records)
+			assert.Nil(t, err)
+
+			golden := filepath.Join("testdata", tt.name+".golden")
+			if *update {
+				if err := os.WriteFile(golden, buf.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			expected, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, string(expected), buf.String())
+		})
+	}
+}
+
+func TestRenderView(t *testing.T) {
+	var buf bytes.Buffer
+	err := RenderView(&buf, []unboundlib.RR{
+		{Name: "a.test.lan.", TTL: 300, Type: "A", Value: "192.168.2.2"},
+		{Name: "a.test.lan", TTL: 300, Type: "A", Value: "192.168.2.1"},
+	})
+	assert.Nil(t, err)
+
+	golden := filepath.Join("testdata", "view.golden")
+	if *update {
+		if err := os.WriteFile(golden, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, string(expected), buf.String())
+}
+
+func TestViewPath(t *testing.T) {
+	assert.Equal(t, "/etc/unbound/external-dns.office.conf", ViewPath("/etc/unbound/external-dns.conf", "office"))
+	assert.Equal(t, "/etc/unbound/external-dns.a_b", ViewPath("/etc/unbound/external-dns", "a/b"))
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "external-dns.conf")
+
+	records := []unboundlib.RR{
+		{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"},
+	}
+	err := WriteFile(path, nil, records)
+	assert.Nil(t, err)
+
+	err = WriteFile(path, nil, append(records, unboundlib.RR{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.2"}))
+	assert.Nil(t, err)
+
+	content, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, header+`server:
+  local-data: "test.lan. 300 IN A 192.168.1.1"
+  local-data: "test.lan. 300 IN A 192.168.1.2"
+`, string(content))
+
+	// No temporary file must be left behind
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+
+	err = WriteFile(filepath.Join(dir, "notexist", "external-dns.conf"), nil, records)
+	assert.NotNil(t, err)
+}
+
+func TestReadZones(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "external-dns.conf")
+
+	zones := []Zone{{Name: "example.com.", Type: "transparent"}, {Name: "test.lan.", Type: "static"}}
+	err := WriteFile(path, zones, []unboundlib.RR{{Name: "test.lan.", TTL: 300, Type: "A", Value: "192.168.1.1"}})
+	assert.Nil(t, err)
+
+	read, err := ReadZones(path)
+	assert.Nil(t, err)
+	assert.Equal(t, zones, read)
+
+	read, err = ReadZones(filepath.Join(dir, "missing.conf"))
+	assert.Nil(t, err)
+	assert.Empty(t, read)
+
+	if err := os.WriteFile(path, []byte("server:\n  local-zone: \"test.lan.\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = ReadZones(path)
+	assert.ErrorContains(t, err, `invalid local zone "local-zone: \"test.lan.\""`)
+}